@@ -4,8 +4,10 @@ go 1.22.0
 
 require (
 	github.com/dylrich/wtgo v0.0.0-20240312023354-e3b0b2f8b058
-	golang.org/x/sync v0.6.0
+	go.mongodb.org/mongo-driver/v2 v2.4.0
+	golang.org/x/sync v0.11.0
 	golang.org/x/term v0.18.0
+	google.golang.org/protobuf v1.33.0
 )
 
 require golang.org/x/sys v0.18.0 // indirect
@@ -1,6 +1,9 @@
 package ansiesc
 
-import "fmt"
+import (
+	"encoding/base64"
+	"fmt"
+)
 
 func ShowCursor() string {
 	return CSI + "?25h"
@@ -26,12 +29,30 @@ func MoveToBeginningOfLine() string {
 	return CSI + "1000D"
 }
 
+// EnableMouse reports presses, drags with a button held and releases, with
+// coordinates in SGR form (?1006) so they aren't capped at column 223.
 func EnableMouse() string {
-	return CSI + "?1000h"
+	return CSI + "?1000h" + CSI + "?1002h" + CSI + "?1006h"
 }
 
 func DisableMouse() string {
-	return CSI + "?1000l"
+	return CSI + "?1006l" + CSI + "?1002l" + CSI + "?1000l"
+}
+
+// EnableBracketedPaste makes the terminal wrap pasted text in markers, so
+// it can be told apart from typing.
+func EnableBracketedPaste() string {
+	return CSI + "?2004h"
+}
+
+func DisableBracketedPaste() string {
+	return CSI + "?2004l"
+}
+
+// CopyToClipboard sets the system clipboard through OSC 52. Terminals that
+// don't support it, or have it disabled, ignore the sequence.
+func CopyToClipboard(s string) string {
+	return OSC + "52;c;" + base64.StdEncoding.EncodeToString([]byte(s)) + "\a"
 }
 
 func MoveDown(n int) string {
@@ -42,4 +63,22 @@ func ClearScreen() string {
 	return CSI + "2J"
 }
 
+func EnterAlternateScreen() string {
+	return CSI + "?1049h"
+}
+
+func ExitAlternateScreen() string {
+	return CSI + "?1049l"
+}
+
+func BeginSynchronizedUpdate() string {
+	return CSI + "?2026h"
+}
+
+func EndSynchronizedUpdate() string {
+	return CSI + "?2026l"
+}
+
 const CSI = "\x1b["
+
+const OSC = "\x1b]"
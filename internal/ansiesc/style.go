@@ -0,0 +1,229 @@
+package ansiesc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type ColorKind uint8
+
+const (
+	ColorDefault ColorKind = iota
+	ColorANSI
+	Color256
+	ColorRGB
+)
+
+type Color struct {
+	Kind  ColorKind
+	Index uint8
+	R     uint8
+	G     uint8
+	B     uint8
+}
+
+func ANSIColor(n uint8) Color {
+	return Color{Kind: ColorANSI, Index: n % 16}
+}
+
+func IndexedColor(n uint8) Color {
+	return Color{Kind: Color256, Index: n}
+}
+
+func RGBColor(r, g, b uint8) Color {
+	return Color{Kind: ColorRGB, R: r, G: g, B: b}
+}
+
+const (
+	Black uint8 = iota
+	Red
+	Green
+	Yellow
+	Blue
+	Magenta
+	Cyan
+	White
+	BrightBlack
+	BrightRed
+	BrightGreen
+	BrightYellow
+	BrightBlue
+	BrightMagenta
+	BrightCyan
+	BrightWhite
+)
+
+type Style struct {
+	Foreground Color
+	Background Color
+	Bold       bool
+	Dim        bool
+	Underline  bool
+	Reverse    bool
+}
+
+func (s Style) WithoutColor() Style {
+	s.Foreground = Color{}
+	s.Background = Color{}
+
+	return s
+}
+
+func (c Color) parameters(background bool) string {
+	switch c.Kind {
+	case ColorANSI:
+		base := 30
+		if background {
+			base = 40
+		}
+
+		if c.Index >= 8 {
+			return strconv.Itoa(base + 60 + int(c.Index-8))
+		}
+
+		return strconv.Itoa(base + int(c.Index))
+	case Color256:
+		if background {
+			return fmt.Sprintf("48;5;%d", c.Index)
+		}
+
+		return fmt.Sprintf("38;5;%d", c.Index)
+	case ColorRGB:
+		if background {
+			return fmt.Sprintf("48;2;%d;%d;%d", c.R, c.G, c.B)
+		}
+
+		return fmt.Sprintf("38;2;%d;%d;%d", c.R, c.G, c.B)
+	}
+
+	return ""
+}
+
+// SetStyle resets all attributes and then applies s, so the result does not
+// depend on whatever style was active before.
+func SetStyle(s Style) string {
+	params := []string{"0"}
+
+	if s.Bold {
+		params = append(params, "1")
+	}
+
+	if s.Dim {
+		params = append(params, "2")
+	}
+
+	if s.Underline {
+		params = append(params, "4")
+	}
+
+	if s.Reverse {
+		params = append(params, "7")
+	}
+
+	if p := s.Foreground.parameters(false); p != "" {
+		params = append(params, p)
+	}
+
+	if p := s.Background.parameters(true); p != "" {
+		params = append(params, p)
+	}
+
+	return CSI + strings.Join(params, ";") + "m"
+}
+
+func ResetStyle() string {
+	return CSI + "0m"
+}
+
+var colorNames = map[string]uint8{
+	"black":          Black,
+	"red":            Red,
+	"green":          Green,
+	"yellow":         Yellow,
+	"blue":           Blue,
+	"magenta":        Magenta,
+	"cyan":           Cyan,
+	"white":          White,
+	"gray":           BrightBlack,
+	"grey":           BrightBlack,
+	"bright-black":   BrightBlack,
+	"bright-red":     BrightRed,
+	"bright-green":   BrightGreen,
+	"bright-yellow":  BrightYellow,
+	"bright-blue":    BrightBlue,
+	"bright-magenta": BrightMagenta,
+	"bright-cyan":    BrightCyan,
+	"bright-white":   BrightWhite,
+}
+
+// ParseColor accepts a color name ("red", "bright-blue"), a 256 color index
+// ("214") or a hex RGB value ("#ffaa00").
+func ParseColor(s string) (Color, error) {
+	if n, ok := colorNames[s]; ok {
+		return ANSIColor(n), nil
+	}
+
+	if s == "default" {
+		return Color{}, nil
+	}
+
+	if strings.HasPrefix(s, "#") && len(s) == 7 {
+		v, err := strconv.ParseUint(s[1:], 16, 32)
+		if err != nil {
+			return Color{}, fmt.Errorf("'%s' is not a valid hex color", s)
+		}
+
+		return RGBColor(uint8(v>>16), uint8(v>>8), uint8(v)), nil
+	}
+
+	n, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return Color{}, fmt.Errorf("'%s' is not a valid color", s)
+	}
+
+	return IndexedColor(uint8(n)), nil
+}
+
+// ParseStyle parses specs such as "bold red", "214 underline" or
+// "#ffffff on blue".
+func ParseStyle(spec string) (Style, error) {
+	var s Style
+
+	words := strings.Fields(spec)
+
+	for i := 0; i < len(words); i++ {
+		switch w := strings.ToLower(words[i]); w {
+		case "bold":
+			s.Bold = true
+		case "dim":
+			s.Dim = true
+		case "underline":
+			s.Underline = true
+		case "reverse":
+			s.Reverse = true
+		case "plain", "none":
+		case "on":
+			if i+1 >= len(words) {
+				return Style{}, fmt.Errorf("expected a color after 'on'")
+			}
+
+			c, err := ParseColor(strings.ToLower(words[i+1]))
+			if err != nil {
+				return Style{}, err
+			}
+
+			s.Background = c
+			i++
+		default:
+			c, err := ParseColor(w)
+			if err != nil {
+				return Style{}, err
+			}
+
+			s.Foreground = c
+		}
+	}
+
+	return s, nil
+}
@@ -55,6 +55,11 @@ func (r *Reader) Run(ctx context.Context) error {
 		case <-done:
 			return nil
 		case events := <-ch:
+			// reads in the middle of a paste produce nothing yet
+			if len(events) == 0 {
+				continue
+			}
+
 			r.receiver.Input(events)
 		}
 	}
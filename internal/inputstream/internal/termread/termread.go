@@ -1,9 +1,11 @@
 package termread
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"log"
+	"strings"
 	"unicode/utf8"
 	"wtsh/internal/termin"
 )
@@ -12,8 +14,18 @@ type Consumer struct {
 	in     io.Reader
 	buf    []byte
 	logger *log.Logger
+	// pending holds the start of a UTF-8 sequence split across reads
+	pending []byte
+	// paste collects text between the bracketed paste markers, and is nil
+	// outside of a paste
+	paste []byte
 }
 
+var (
+	pasteStart = []byte("\x1b[200~")
+	pasteEnd   = []byte("\x1b[201~")
+)
+
 func New(r io.Reader, logger *log.Logger) *Consumer {
 	return &Consumer{
 		in:     r,
@@ -28,7 +40,54 @@ func (r *Consumer) Poll() ([]termin.Event, error) {
 		return nil, fmt.Errorf("reader: %w", err)
 	}
 
-	b := r.buf[:n]
+	b := append(r.pending, r.buf[:n]...)
+	r.pending = nil
+
+	events := make([]termin.Event, 0)
+
+	for len(b) > 0 {
+		if r.paste != nil {
+			r.paste = append(r.paste, b...)
+
+			i := bytes.Index(r.paste, pasteEnd)
+			if i < 0 {
+				break
+			}
+
+			events = append(events, termin.Paste{Text: normalizeNewlines(string(r.paste[:i]))})
+			b = r.paste[i+len(pasteEnd):]
+			r.paste = nil
+
+			continue
+		}
+
+		i := bytes.Index(b, pasteStart)
+		if i < 0 {
+			events = append(events, r.keys(b)...)
+			break
+		}
+
+		events = append(events, r.keys(b[:i])...)
+		b = b[i+len(pasteStart):]
+		r.paste = []byte{}
+	}
+
+	return events, nil
+}
+
+func normalizeNewlines(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\r", "\n")
+}
+
+func (r *Consumer) keys(b []byte) []termin.Event {
+	// keep an incomplete trailing rune or paste marker for the next read
+	if start := lastRuneStart(b); !utf8.FullRune(b[start:]) {
+		r.pending = append([]byte{}, b[start:]...)
+		b = b[:start]
+	} else if n := partialPasteStart(b); n > 0 {
+		r.pending = append([]byte{}, b[len(b)-n:]...)
+		b = b[:len(b)-n]
+	}
 
 	runes := make([]rune, 0)
 	for i := 0; i < len(b); {
@@ -74,42 +133,23 @@ func (r *Consumer) Poll() ([]termin.Event, error) {
 						X: int(runes[i+2]) - 1,
 						Y: int(runes[i+3]) - 1,
 					}
-					b := runes[i+1]
-					b -= 32
+					b := int(runes[i+1]) - 32
 					i += 3
 
-					var mods termin.Modifiers
-
-					if b&(1<<2) != 0 {
-						mods.Control = true
+					if e := mouseEvent(b, p, b&3 == 3 && b&(1<<6) == 0); e != nil {
+						keys = append(keys, e)
 					}
-
-					if b&(1<<3) != 0 {
-						mods.Alt = true
+				case 60:
+					// SGR mouse events, CSI < b ; x ; y M or m on release
+					e, n, ok := parseSGRMouse(runes[i+1:])
+					if !ok {
+						break
 					}
 
-					if b&(1<<4) != 0 {
-						mods.Shift = true
-					}
+					i += n
 
-					if b&(1<<6) != 0 {
-						switch b & 3 {
-						case 0:
-							keys = append(keys, termin.MouseScroll{Point: p, Modifiers: mods, Direction: termin.ScrollUp})
-						case 1:
-							keys = append(keys, termin.MouseScroll{Point: p, Modifiers: mods, Direction: termin.ScrollDown})
-						}
-					} else {
-						switch b & 3 {
-						case 0:
-							keys = append(keys, termin.MousePress{Point: p, Modifiers: mods, Key: termin.MouseLeft})
-						case 1:
-							keys = append(keys, termin.MousePress{Point: p, Modifiers: mods, Key: termin.MouseMiddle})
-						case 2:
-							keys = append(keys, termin.MousePress{Point: p, Modifiers: mods, Key: termin.MouseRight})
-						case 3:
-							keys = append(keys, termin.MouseRelease{Point: p, Modifiers: mods})
-						}
+					if e != nil {
+						keys = append(keys, e)
 					}
 				case 65:
 					keys = append(keys, termin.Key{Type: termin.KeyUp})
@@ -119,6 +159,17 @@ func (r *Consumer) Poll() ([]termin.Event, error) {
 					keys = append(keys, termin.Key{Type: termin.KeyRight})
 				case 68:
 					keys = append(keys, termin.Key{Type: termin.KeyLeft})
+				case 53, 54:
+					// CSI 5 ~ and CSI 6 ~
+					if i+1 < len(runes) && runes[i+1] == '~' {
+						i++
+
+						if k == 53 {
+							keys = append(keys, termin.Key{Type: termin.KeyPageUp})
+						} else {
+							keys = append(keys, termin.Key{Type: termin.KeyPageDown})
+						}
+					}
 				}
 			}
 		case 127:
@@ -128,5 +179,91 @@ func (r *Consumer) Poll() ([]termin.Event, error) {
 		}
 	}
 
-	return keys, nil
+	return keys
+}
+
+// partialPasteStart returns the length of a paste marker cut off at the end
+// of b. Shorter prefixes are left alone so escape and arrow keys go through.
+func partialPasteStart(b []byte) int {
+	for n := len(pasteStart) - 1; n >= 3; n-- {
+		if bytes.HasSuffix(b, pasteStart[:n]) {
+			return n
+		}
+	}
+
+	return 0
+}
+
+func lastRuneStart(b []byte) int {
+	i := len(b) - 1
+	for i > 0 && len(b)-i < utf8.UTFMax && !utf8.RuneStart(b[i]) {
+		i--
+	}
+
+	return max(i, 0)
+}
+
+func parseSGRMouse(runes []rune) (termin.Event, int, bool) {
+	params := [3]int{}
+	field := 0
+
+	for n, r := range runes {
+		switch {
+		case r >= '0' && r <= '9':
+			params[field] = params[field]*10 + int(r-'0')
+		case r == ';' && field < 2:
+			field++
+		case (r == 'M' || r == 'm') && field == 2:
+			p := termin.Point{X: params[1] - 1, Y: params[2] - 1}
+			return mouseEvent(params[0], p, r == 'm'), n + 1, true
+		default:
+			return nil, 0, false
+		}
+	}
+
+	return nil, 0, false
+}
+
+// mouseEvent decodes the button byte shared by the X10 and SGR encodings.
+func mouseEvent(b int, p termin.Point, release bool) termin.Event {
+	mods := termin.Modifiers{
+		Shift:   b&(1<<2) != 0,
+		Alt:     b&(1<<3) != 0,
+		Control: b&(1<<4) != 0,
+	}
+
+	if b&(1<<6) != 0 {
+		switch b & 3 {
+		case 0:
+			return termin.MouseScroll{Point: p, Modifiers: mods, Direction: termin.ScrollUp}
+		case 1:
+			return termin.MouseScroll{Point: p, Modifiers: mods, Direction: termin.ScrollDown}
+		}
+
+		return nil
+	}
+
+	if release {
+		return termin.MouseRelease{Point: p, Modifiers: mods}
+	}
+
+	var key termin.MouseKeyType
+
+	switch b & 3 {
+	case 0:
+		key = termin.MouseLeft
+	case 1:
+		key = termin.MouseMiddle
+	case 2:
+		key = termin.MouseRight
+	default:
+		// motion without a button held isn't requested
+		return nil
+	}
+
+	if b&(1<<5) != 0 {
+		return termin.MouseMotion{Point: p, Modifiers: mods, Key: key}
+	}
+
+	return termin.MousePress{Point: p, Modifiers: mods, Key: key}
 }
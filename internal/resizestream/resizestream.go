@@ -4,6 +4,9 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"golang.org/x/term"
@@ -27,31 +30,55 @@ func New(fd int, logger *log.Logger, receiver Receiver) *Listener {
 	}
 }
 
+const (
+	// settle is how long to wait after a SIGWINCH for more to arrive, so a
+	// window being dragged produces one resize per burst
+	settle = 20 * time.Millisecond
+	// fallback catches size changes that arrive without a signal, such as
+	// when the terminal isn't the controlling terminal
+	fallback = 5 * time.Second
+)
+
 func (a Listener) Run(ctx context.Context) error {
 	var width, height int
 
-	ticker := time.NewTicker(100 * time.Millisecond)
+	check := func() {
+		w, h, err := term.GetSize(a.fd)
+		if err != nil {
+			a.logger.Println(fmt.Errorf("get term size: %w", err))
+			return
+		}
+
+		if width == w && height == h {
+			return
+		}
+
+		a.receiver.Resize(w, h)
+
+		width = w
+		height = h
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGWINCH)
+	defer signal.Stop(signals)
+
+	ticker := time.NewTicker(fallback)
+	defer ticker.Stop()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
-			ticker.Stop()
 			return nil
+		case <-signals:
+			timer.Reset(settle)
+		case <-timer.C:
+			check()
 		case <-ticker.C:
-			w, h, err := term.GetSize(a.fd)
-			if err != nil {
-				a.logger.Println(fmt.Errorf("get term size: %w", err))
-				continue
-			}
-
-			if width == w && height == h {
-				continue
-			}
-
-			a.receiver.Resize(w, h)
-
-			width = w
-			height = h
+			check()
 		}
 	}
 }
@@ -21,6 +21,8 @@ const (
 	KeyEnter
 	KeyQuit
 	KeyTab
+	KeyPageUp
+	KeyPageDown
 )
 
 type MouseKeyType int
@@ -55,6 +57,13 @@ type MouseScroll struct {
 	Direction ScrollDirection
 }
 
+// MouseMotion is reported while the mouse moves with Key held down.
+type MouseMotion struct {
+	Point     Point
+	Key       MouseKeyType
+	Modifiers Modifiers
+}
+
 type MouseRelease struct {
 	Point     Point
 	Modifiers Modifiers
@@ -66,5 +75,11 @@ type Modifiers struct {
 	Control bool
 }
 
+// Paste is text pasted while bracketed paste mode is enabled, with line
+// endings normalized to "\n".
+type Paste struct {
+	Text string
+}
+
 type Event interface {
 }
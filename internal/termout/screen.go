@@ -0,0 +1,259 @@
+package termout
+
+import (
+	"bytes"
+	"io"
+	"unicode/utf8"
+	"wtsh/internal/ansiesc"
+)
+
+type Cell struct {
+	Rune  rune
+	Style ansiesc.Style
+}
+
+var blank = Cell{Rune: ' '}
+
+// Screen is a double buffered grid of cells. Drawing only touches the back
+// buffer, and Flush writes the difference to the front buffer in one write.
+type Screen struct {
+	out    io.Writer
+	width  int
+	height int
+	front  []Cell
+	back   []Cell
+	buf    bytes.Buffer
+
+	cursorRow     int
+	cursorColumn  int
+	cursorVisible bool
+
+	redraw       bool
+	synchronized bool
+	style        ansiesc.Style
+}
+
+func NewScreen(w io.Writer, width, height int) *Screen {
+	s := &Screen{
+		out:           w,
+		cursorVisible: true,
+		synchronized:  true,
+	}
+
+	s.Resize(width, height)
+
+	return s
+}
+
+func (s *Screen) Width() int {
+	return s.width
+}
+
+func (s *Screen) Height() int {
+	return s.height
+}
+
+// SetSynchronized toggles wrapping each frame in synchronized output mode
+// (CSI ?2026). Terminals without support ignore the sequence.
+func (s *Screen) SetSynchronized(enabled bool) {
+	s.synchronized = enabled
+}
+
+// Resize discards both buffers. The next Flush clears the terminal and
+// redraws every cell, since the terminal may have reflowed its contents.
+func (s *Screen) Resize(width, height int) {
+	if width < 0 {
+		width = 0
+	}
+
+	if height < 0 {
+		height = 0
+	}
+
+	s.width = width
+	s.height = height
+	s.front = make([]Cell, width*height)
+	s.back = make([]Cell, width*height)
+
+	for i := range s.front {
+		s.front[i] = blank
+		s.back[i] = blank
+	}
+
+	s.redraw = true
+}
+
+func (s *Screen) Invalidate() {
+	s.redraw = true
+}
+
+func (s *Screen) Clear() {
+	for i := range s.back {
+		s.back[i] = blank
+	}
+}
+
+func (s *Screen) ClearRow(row int) {
+	if row < 0 || row >= s.height {
+		return
+	}
+
+	for i := row * s.width; i < (row+1)*s.width; i++ {
+		s.back[i] = blank
+	}
+}
+
+func (s *Screen) SetCell(row, column int, c Cell) {
+	if row < 0 || row >= s.height || column < 0 || column >= s.width {
+		return
+	}
+
+	if c.Rune < ' ' || c.Rune == utf8.RuneError {
+		c.Rune = ' '
+	}
+
+	s.back[row*s.width+column] = c
+}
+
+// WriteString draws str from (row, column), clipping at the right edge, and
+// returns the column after the last rune written.
+func (s *Screen) WriteString(row, column int, str string) int {
+	return s.WriteStyled(row, column, str, ansiesc.Style{})
+}
+
+func (s *Screen) WriteStyled(row, column int, str string, style ansiesc.Style) int {
+	for _, r := range str {
+		if column >= s.width {
+			break
+		}
+
+		s.SetCell(row, column, Cell{Rune: r, Style: style})
+		column++
+	}
+
+	return column
+}
+
+// Reverse flips the cells of row in [from, to) to reverse video, e.g. to
+// show a selection over text already drawn.
+func (s *Screen) Reverse(row, from, to int) {
+	if row < 0 || row >= s.height {
+		return
+	}
+
+	for column := max(from, 0); column < min(to, s.width); column++ {
+		c := &s.back[row*s.width+column]
+		c.Style.Reverse = !c.Style.Reverse
+	}
+}
+
+func (s *Screen) SetCursor(row, column int) {
+	s.cursorRow = row
+	s.cursorColumn = column
+}
+
+func (s *Screen) ShowCursor(visible bool) {
+	s.cursorVisible = visible
+}
+
+func (s *Screen) Flush() error {
+	s.buf.Reset()
+
+	if s.synchronized {
+		s.buf.WriteString(ansiesc.BeginSynchronizedUpdate())
+	}
+
+	s.buf.WriteString(ansiesc.HideCursor() + ansiesc.ResetStyle())
+	s.style = ansiesc.Style{}
+
+	if s.redraw {
+		s.buf.WriteString(ansiesc.ClearScreen())
+
+		for i := range s.front {
+			s.front[i] = blank
+		}
+	}
+
+	for row := 0; row < s.height; row++ {
+		s.flushRow(row)
+	}
+
+	s.redraw = false
+
+	s.setStyle(ansiesc.Style{})
+	s.buf.WriteString(ansiesc.SetPosition(s.cursorRow, s.cursorColumn))
+
+	if s.cursorVisible {
+		s.buf.WriteString(ansiesc.ShowCursor())
+	}
+
+	if s.synchronized {
+		s.buf.WriteString(ansiesc.EndSynchronizedUpdate())
+	}
+
+	_, err := s.out.Write(s.buf.Bytes())
+
+	return err
+}
+
+func (s *Screen) flushRow(row int) {
+	front := s.front[row*s.width : (row+1)*s.width]
+	back := s.back[row*s.width : (row+1)*s.width]
+
+	// past this column the back buffer is blank, so one erase covers it
+	end := len(back)
+	for end > 0 && back[end-1] == blank {
+		end--
+	}
+
+	position := -1
+
+	for column := 0; column < end; column++ {
+		if front[column] == back[column] {
+			continue
+		}
+
+		switch {
+		case position == column:
+		case position != -1 && column-position <= 4:
+			// rewriting a short run of unchanged cells is cheaper than a move
+			for _, c := range back[position:column] {
+				s.writeCell(c)
+			}
+		default:
+			s.buf.WriteString(ansiesc.SetPosition(row, column))
+		}
+
+		s.writeCell(back[column])
+		front[column] = back[column]
+		position = column + 1
+	}
+
+	dirty := false
+	for column := end; column < len(front); column++ {
+		if front[column] != blank {
+			dirty = true
+			front[column] = blank
+		}
+	}
+
+	if dirty {
+		// erasing fills with the active background, so drop it first
+		s.setStyle(ansiesc.Style{})
+		s.buf.WriteString(ansiesc.SetPosition(row, end) + ansiesc.ClearToEndOfLine())
+	}
+}
+
+func (s *Screen) writeCell(c Cell) {
+	s.setStyle(c.Style)
+	s.buf.WriteRune(c.Rune)
+}
+
+func (s *Screen) setStyle(style ansiesc.Style) {
+	if style == s.style {
+		return
+	}
+
+	s.buf.WriteString(ansiesc.SetStyle(style))
+	s.style = style
+}
@@ -0,0 +1,75 @@
+package wtshapp
+
+import (
+	"fmt"
+	"strings"
+	"wtsh/internal/wtshmsg"
+)
+
+// benchLines draws the live view of a running bench: throughput, the
+// latency of each operation and a histogram of the last interval.
+func benchLines(m wtshmsg.BenchProgressMessage, theme Theme, width int) []line {
+	lines := []line{{
+		{text: fmt.Sprintf("bench %s", m.URI), style: theme.Header},
+		{text: fmt.Sprintf("  %.0fs/%.0fs  %.0f ops/s", m.Elapsed.Seconds(), m.Duration.Seconds(), m.Throughput)},
+	}}
+
+	for _, op := range m.Ops {
+		lines = append(lines, line{
+			{text: fmt.Sprintf("%-8s", op.Name), style: theme.Key},
+			{text: fmt.Sprintf("%10d ops  p50 %-8s p99 %s", op.Ops, wtshmsg.FormatLatency(op.P50), wtshmsg.FormatLatency(op.P99))},
+		})
+	}
+
+	var most int64
+	for _, b := range m.Histogram {
+		most = max(most, b.Count)
+	}
+
+	const label = 10
+
+	bar := max(width-label-12, 1)
+
+	for _, b := range m.Histogram {
+		n := 0
+		if most > 0 {
+			n = int(b.Count * int64(bar) / most)
+		}
+
+		lines = append(lines, line{
+			{text: fmt.Sprintf("%*s ", label-1, "≤"+wtshmsg.FormatLatency(b.Upper)), style: theme.Echo},
+			{text: strings.Repeat("█", n), style: theme.Number},
+			{text: fmt.Sprintf(" %d", b.Count), style: theme.Echo},
+		})
+	}
+
+	return lines
+}
+
+// renderBench draws the bench view in the rows between the logs and the
+// status bar, keeping the first lines if it doesn't fit.
+func (p *Program) renderBench() {
+	lines := p.benchLines()
+	top := p.logSpace()
+
+	for i, l := range lines {
+		column := 0
+
+		for _, sp := range l {
+			column = p.screen.WriteStyled(top+i, column, sp.text, sp.style)
+		}
+	}
+}
+
+// benchLines returns the bench view cut to at most half of the space above
+// the input box, or nil if no bench is running.
+func (p *Program) benchLines() []line {
+	if p.model.bench == nil {
+		return nil
+	}
+
+	lines := benchLines(*p.model.bench, p.theme, p.model.width)
+	space := max(p.model.height-p.box.height(p.model.width)-1, 0) / 2
+
+	return lines[:min(len(lines), space)]
+}
@@ -0,0 +1,372 @@
+package wtshapp
+
+import (
+	"fmt"
+	"strings"
+	"wtsh/internal/ansiesc"
+	"wtsh/internal/termin"
+	"wtsh/internal/termout"
+	"wtsh/internal/wtshmsg"
+)
+
+// browseView is the full-screen grid opened by the browse command. Rows are
+// fetched a page at a time from the executor as the selection nears either
+// end of what has been loaded.
+type browseView struct {
+	uri      string
+	columns  []wtshmsg.Column
+	keys     int
+	rows     []wtshmsg.BrowseRow
+	widths   []int
+	numeric  []bool
+	selected int
+	top      int
+	// visible is the number of grid rows shown by the last render
+	visible int
+
+	atStart bool
+	atEnd   bool
+	pending bool
+
+	detail    bool
+	searching bool
+	query     string
+	status    string
+
+	send  func(s string)
+	theme Theme
+}
+
+// the title, header and rule take up the first rows of the grid
+const browseGridOffset = 3
+
+func newBrowseView(m wtshmsg.BrowseOpenMessage, send func(s string), theme Theme) *browseView {
+	v := &browseView{
+		uri:     m.URI,
+		columns: m.Columns,
+		keys:    m.Keys,
+		atStart: true,
+		send:    send,
+		theme:   theme,
+	}
+
+	v.layout()
+	v.fetch("browse-next")
+
+	return v
+}
+
+func (v *browseView) fetch(cmd string) {
+	v.pending = true
+	v.send(cmd)
+}
+
+func (v *browseView) page(m wtshmsg.BrowsePageMessage) {
+	v.pending = false
+
+	if len(m.Columns) > 0 {
+		v.columns = m.Columns
+		v.keys = m.Keys
+	}
+
+	switch m.Direction {
+	case wtshmsg.BrowseNext:
+		v.rows = append(v.rows, m.Rows...)
+		v.atEnd = m.End
+	case wtshmsg.BrowsePrev:
+		v.rows = append(append([]wtshmsg.BrowseRow{}, m.Rows...), v.rows...)
+		v.selected += len(m.Rows)
+		v.top += len(m.Rows)
+		v.atStart = m.End
+	case wtshmsg.BrowseSeek:
+		v.rows = m.Rows
+		v.selected = 0
+		v.top = 0
+		v.atStart = false
+		v.atEnd = m.End
+
+		if len(m.Rows) == 0 {
+			v.status = "no records"
+		}
+	}
+
+	v.layout()
+	v.scroll()
+}
+
+func (v *browseView) layout() {
+	m := wtshmsg.ResultMessage{Columns: v.columns, Rows: make([][]string, len(v.rows))}
+	for i, row := range v.rows {
+		m.Rows[i] = row.Cells
+	}
+
+	v.widths = m.Widths()
+	v.numeric = make([]bool, len(v.widths))
+
+	for i := range v.widths {
+		v.numeric[i] = m.Numeric(i)
+	}
+}
+
+// Update handles an input event and reports whether the view was closed.
+func (v *browseView) Update(e termin.Event) bool {
+	if v.searching {
+		v.updateSearch(e)
+		return false
+	}
+
+	switch e := e.(type) {
+	case termin.Key:
+		switch e.Type {
+		case termin.KeyUp:
+			v.move(-1)
+		case termin.KeyDown:
+			v.move(1)
+		case termin.KeyPageUp:
+			v.move(-max(v.visible, 1))
+		case termin.KeyPageDown:
+			v.move(max(v.visible, 1))
+		case termin.KeyEnter:
+			v.detail = !v.detail && len(v.rows) > 0
+		case termin.KeyEscape:
+			v.detail = false
+		case termin.KeyCharacter:
+			switch e.Rune {
+			case 'q':
+				if v.detail {
+					v.detail = false
+					break
+				}
+
+				v.send("browse-close")
+				return true
+			case '/':
+				v.searching = true
+				v.query = ""
+				v.status = ""
+			case 'j':
+				v.move(1)
+			case 'k':
+				v.move(-1)
+			}
+		}
+	case termin.MousePress:
+		row := v.top + e.Point.Y - browseGridOffset
+		if e.Key != termin.MouseLeft || e.Point.Y < browseGridOffset || row >= len(v.rows) || row >= v.top+v.visible {
+			break
+		}
+
+		// clicking the selected row again opens it
+		if row == v.selected {
+			v.detail = !v.detail
+			break
+		}
+
+		v.move(row - v.selected)
+	case termin.MouseScroll:
+		if e.Direction == termin.ScrollUp {
+			v.move(-3)
+		} else {
+			v.move(3)
+		}
+	}
+
+	return false
+}
+
+func (v *browseView) updateSearch(e termin.Event) {
+	k, ok := e.(termin.Key)
+	if !ok {
+		return
+	}
+
+	switch k.Type {
+	case termin.KeyEnter:
+		v.searching = false
+
+		if v.query != "" && !v.pending {
+			v.fetch("browse-seek " + v.query)
+		}
+	case termin.KeyEscape:
+		v.searching = false
+	case termin.KeyBackspace:
+		if v.query == "" {
+			v.searching = false
+			break
+		}
+
+		r := []rune(v.query)
+		v.query = string(r[:len(r)-1])
+	case termin.KeyCharacter:
+		v.query += string(k.Rune)
+	}
+}
+
+func (v *browseView) move(n int) {
+	v.selected = max(0, min(v.selected+n, len(v.rows)-1))
+	v.status = ""
+
+	v.scroll()
+
+	if v.pending {
+		return
+	}
+
+	switch {
+	case !v.atEnd && v.selected >= len(v.rows)-v.visible:
+		v.fetch("browse-next")
+	case !v.atStart && v.selected < v.visible:
+		v.fetch("browse-prev")
+	}
+}
+
+// scroll keeps the selected row within the visible part of the grid.
+func (v *browseView) scroll() {
+	if v.selected < v.top {
+		v.top = v.selected
+	}
+
+	if v.visible > 0 && v.selected >= v.top+v.visible {
+		v.top = v.selected - v.visible + 1
+	}
+}
+
+func (v *browseView) render(s *termout.Screen) {
+	height := s.Height()
+	gridEnd := height - 1 // the last row is the status line
+
+	if v.detail {
+		gridEnd = height / 2
+	}
+
+	v.visible = max(gridEnd-browseGridOffset, 0)
+	v.scroll()
+
+	title := fmt.Sprintf(" %s ", v.uri)
+	if len(v.rows) > 0 {
+		title += fmt.Sprintf("─ row %d of %d", v.selected+1, len(v.rows))
+		if !v.atEnd {
+			title += "+"
+		}
+	}
+
+	s.WriteStyled(0, 0, title, v.theme.Header)
+
+	separator := " │ "
+
+	header := make([]string, len(v.widths))
+	rule := make([]string, len(v.widths))
+
+	for i, w := range v.widths {
+		name := ""
+		if i < len(v.columns) {
+			name = v.columns[i].Name
+		}
+
+		header[i] = wtshmsg.Align(name, w, v.numeric[i])
+		rule[i] = strings.Repeat("─", w)
+	}
+
+	s.WriteStyled(1, 0, " "+strings.Join(header, separator), v.theme.Header)
+	s.WriteStyled(2, 0, "─"+strings.Join(rule, "─┼─"), v.theme.Echo)
+
+	for i := 0; i < v.visible && v.top+i < len(v.rows); i++ {
+		n := v.top + i
+		row := browseGridOffset + i
+
+		column := 0
+		selected := n == v.selected
+
+		for j, w := range v.widths {
+			style := v.theme.Value
+			if j < v.keys {
+				style = v.theme.Key
+			}
+
+			if selected {
+				style.Reverse = true
+			}
+
+			text := separator
+			if j == 0 {
+				text = " "
+			}
+
+			column = s.WriteStyled(row, column, text, ansiesc.Style{Reverse: selected})
+
+			cell := ""
+			if j < len(v.rows[n].Cells) {
+				cell = v.rows[n].Cells[j]
+			}
+
+			column = s.WriteStyled(row, column, wtshmsg.Align(cell, w, v.numeric[j]), style)
+		}
+
+		if selected {
+			s.WriteStyled(row, column, strings.Repeat(" ", max(s.Width()-column, 0)), ansiesc.Style{Reverse: true})
+		}
+	}
+
+	if v.detail {
+		v.renderDetail(s, gridEnd, height-1)
+	}
+
+	s.ShowCursor(v.searching)
+
+	switch {
+	case v.searching:
+		column := s.WriteStyled(height-1, 0, "/", v.theme.Prompt)
+		column = s.WriteString(height-1, column, v.query)
+		s.SetCursor(height-1, column)
+	case v.status != "":
+		s.WriteStyled(height-1, 0, v.status, v.theme.Error)
+	case v.pending:
+		s.WriteStyled(height-1, 0, "loading…", v.theme.Echo)
+	default:
+		s.WriteStyled(height-1, 0, "↑↓ PgUp PgDn move  / seek  Enter detail  q quit", v.theme.Echo)
+	}
+}
+
+// renderDetail shows every column of the selected row in full between rows
+// from and to.
+func (v *browseView) renderDetail(s *termout.Screen, from, to int) {
+	s.WriteStyled(from, 0, strings.Repeat("─", s.Width()), v.theme.Echo)
+
+	if v.selected >= len(v.rows) {
+		return
+	}
+
+	row := from + 1
+	detail := v.rows[v.selected].Detail
+
+	for i, text := range detail {
+		name := fmt.Sprintf("column%d", i)
+		if i < len(v.columns) {
+			name = v.columns[i].Name
+		}
+
+		style := v.theme.Value
+		if i < v.keys {
+			style = v.theme.Key
+		}
+
+		for j, l := range strings.Split(text, "\n") {
+			if row >= to {
+				return
+			}
+
+			label := ""
+			if j == 0 {
+				label = name + ": "
+			}
+
+			column := s.WriteStyled(row, 0, label, v.theme.Header)
+			if j > 0 {
+				column = len([]rune(name)) + 2
+			}
+
+			s.WriteStyled(row, column, l, style)
+			row++
+		}
+	}
+}
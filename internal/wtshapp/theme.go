@@ -0,0 +1,269 @@
+package wtshapp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"wtsh/internal/ansiesc"
+)
+
+type Theme struct {
+	Prompt   ansiesc.Style
+	Command  ansiesc.Style
+	Flag     ansiesc.Style
+	Variable ansiesc.Style
+	String   ansiesc.Style
+	Number   ansiesc.Style
+	Error    ansiesc.Style
+	Success  ansiesc.Style
+	Header   ansiesc.Style
+	Key      ansiesc.Style
+	Value    ansiesc.Style
+	Echo     ansiesc.Style
+	Status   ansiesc.Style
+}
+
+func DefaultTheme() Theme {
+	return Theme{
+		Prompt:   ansiesc.Style{Foreground: ansiesc.ANSIColor(ansiesc.Green), Bold: true},
+		Command:  ansiesc.Style{Bold: true},
+		Flag:     ansiesc.Style{Foreground: ansiesc.ANSIColor(ansiesc.Cyan)},
+		Variable: ansiesc.Style{Foreground: ansiesc.ANSIColor(ansiesc.Magenta)},
+		String:   ansiesc.Style{Foreground: ansiesc.ANSIColor(ansiesc.Yellow)},
+		Number:   ansiesc.Style{Foreground: ansiesc.ANSIColor(ansiesc.Blue)},
+		Error:    ansiesc.Style{Foreground: ansiesc.ANSIColor(ansiesc.Red)},
+		Success:  ansiesc.Style{Foreground: ansiesc.ANSIColor(ansiesc.Green)},
+		Header:   ansiesc.Style{Bold: true, Underline: true},
+		Key:      ansiesc.Style{Foreground: ansiesc.ANSIColor(ansiesc.Cyan)},
+		Value:    ansiesc.Style{},
+		Echo:     ansiesc.Style{Dim: true},
+		Status:   ansiesc.Style{Reverse: true},
+	}
+}
+
+func (t Theme) WithoutColor() Theme {
+	for _, s := range t.styles() {
+		*s = s.WithoutColor()
+	}
+
+	return t
+}
+
+func (t *Theme) styles() map[string]*ansiesc.Style {
+	return map[string]*ansiesc.Style{
+		"prompt":   &t.Prompt,
+		"command":  &t.Command,
+		"flag":     &t.Flag,
+		"variable": &t.Variable,
+		"string":   &t.String,
+		"number":   &t.Number,
+		"error":    &t.Error,
+		"success":  &t.Success,
+		"header":   &t.Header,
+		"key":      &t.Key,
+		"value":    &t.Value,
+		"echo":     &t.Echo,
+		"status":   &t.Status,
+	}
+}
+
+// LoadTheme reads "name = style" lines, e.g. "error = bright-red bold", over
+// the styles in base. Blank lines and lines starting with '#' are ignored.
+func LoadTheme(r io.Reader, base Theme) (Theme, error) {
+	t := base
+	styles := t.styles()
+
+	scanner := bufio.NewScanner(r)
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, spec, ok := strings.Cut(line, "=")
+		if !ok {
+			return Theme{}, fmt.Errorf("line %d: expected <name> = <style>", n)
+		}
+
+		name = strings.TrimSpace(name)
+
+		s, ok := styles[name]
+		if !ok {
+			return Theme{}, fmt.Errorf("line %d: '%s' is not a themeable element", n, name)
+		}
+
+		style, err := ansiesc.ParseStyle(spec)
+		if err != nil {
+			return Theme{}, fmt.Errorf("line %d: %w", n, err)
+		}
+
+		*s = style
+	}
+
+	if err := scanner.Err(); err != nil {
+		return Theme{}, err
+	}
+
+	return t, nil
+}
+
+type span struct {
+	text  string
+	style ansiesc.Style
+}
+
+type line []span
+
+func (l line) String() string {
+	var b strings.Builder
+
+	for _, s := range l {
+		b.WriteString(s.text)
+	}
+
+	return b.String()
+}
+
+// wrap breaks a line into rows of at most width characters. An empty line
+// is still one row.
+func (l line) wrap(width int) []line {
+	if width <= 0 {
+		return []line{l}
+	}
+
+	rows := []line{{}}
+	column := 0
+
+	for _, sp := range l {
+		text := []rune(sp.text)
+
+		for len(text) > 0 {
+			if column == width {
+				rows = append(rows, line{})
+				column = 0
+			}
+
+			n := min(len(text), width-column)
+			rows[len(rows)-1] = append(rows[len(rows)-1], span{text: string(text[:n]), style: sp.style})
+			text = text[n:]
+			column += n
+		}
+	}
+
+	return rows
+}
+
+// highlight splits a command into styled spans: the command name, --flags,
+// $variables, quoted strings and numbers.
+func highlight(s string, t Theme) line {
+	l := make(line, 0, 8)
+
+	add := func(text string, style ansiesc.Style) {
+		if text == "" {
+			return
+		}
+
+		if n := len(l); n > 0 && l[n-1].style == style {
+			l[n-1].text += text
+			return
+		}
+
+		l = append(l, span{text: text, style: style})
+	}
+
+	first := true
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch {
+		case c == ' ':
+			j := i
+			for j < len(s) && s[j] == ' ' {
+				j++
+			}
+
+			add(s[i:j], ansiesc.Style{})
+			i = j
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(s) && s[j] != c {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+
+			if j < len(s) {
+				j++
+			} else {
+				j = len(s)
+			}
+
+			add(s[i:j], t.String)
+			i = j
+			first = false
+		case c == '$':
+			j := i + 1
+			if j < len(s) && s[j] == '{' {
+				for j < len(s) && s[j] != '}' {
+					j++
+				}
+
+				if j < len(s) {
+					j++
+				}
+			} else {
+				for j < len(s) && strings.IndexByte(" ,;\"'(){}", s[j]) == -1 {
+					j++
+				}
+			}
+
+			add(s[i:j], t.Variable)
+			i = j
+			first = false
+		default:
+			j := i
+			for j < len(s) && strings.IndexByte(" \"'$", s[j]) == -1 {
+				j++
+			}
+
+			word := s[i:j]
+
+			switch {
+			case first:
+				add(word, t.Command)
+			case strings.HasPrefix(word, "--"):
+				add(word, t.Flag)
+			case isNumber(word):
+				add(word, t.Number)
+			default:
+				add(word, ansiesc.Style{})
+			}
+
+			i = j
+			first = false
+		}
+	}
+
+	return l
+}
+
+func isNumber(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+
+	if s == "" {
+		return false
+	}
+
+	for i := 0; i < len(s); i++ {
+		if (s[i] < '0' || s[i] > '9') && s[i] != '.' {
+			return false
+		}
+	}
+
+	return true
+}
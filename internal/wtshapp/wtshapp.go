@@ -5,8 +5,9 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"os"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 	"unicode/utf8"
 	"wtsh/internal/ansiesc"
@@ -26,22 +27,22 @@ type Config struct {
 	Cancel         context.CancelFunc
 	CommandChannel chan<- string
 	Logger         *log.Logger
-	Home           string
-	OpenConfig     string
-	SessionConfig  string
-	CursorConfig   string
-	URI            string
+	Startup        []string
+	Theme          Theme
 }
 
 func New(conf Config) *Program {
 	w := termout.New(conf.Stdout)
+	screen := termout.NewScreen(conf.Stdout, conf.InitialWidth, conf.InitialHeight)
 
 	m := &model{
 		height:   conf.InitialHeight,
 		width:    conf.InitialWidth,
-		messages: make([]string, 0, 10),
+		messages: make([]line, 0, 10),
 	}
 
+	theme := conf.Theme
+
 	commandHandler := func(s string) {
 		// skip if no one is reading
 		select {
@@ -54,7 +55,15 @@ func New(conf Config) *Program {
 
 	onSubmit := func(p, s string) {
 		commandHandler(s)
-		m.addLog(p + s)
+
+		// pasted scripts echo one line at a time
+		for i, l := range strings.Split(s, "\n") {
+			if i > 0 {
+				p = strings.Repeat(" ", utf8.RuneCountInString(p))
+			}
+
+			m.addLine(append(line{{text: p, style: theme.Prompt}}, highlight(l, theme)...))
+		}
 	}
 
 	return &Program{
@@ -63,29 +72,26 @@ func New(conf Config) *Program {
 		fd:             conf.FileDescriptor,
 		old:            conf.TermState,
 		writer:         w,
+		screen:         screen,
 		logger:         conf.Logger,
 		cancel:         conf.Cancel,
-		box:            newInputbox(conf.Logger, onSubmit),
-		logs:           newLogs(w),
+		box:            newInputbox(conf.Logger, theme, onSubmit),
+		logs:           newLogs(),
 		model:          m,
-		home:           conf.Home,
-		openConfig:     conf.OpenConfig,
-		sessionConfig:  conf.SessionConfig,
-		cursorConfig:   conf.CursorConfig,
-		uri:            conf.URI,
+		startup:        conf.Startup,
 		commandHandler: commandHandler,
+		theme:          theme,
 	}
 }
 
-func (m *model) addLogSplit(s string) {
-	lines := strings.Split(s, "\n")
-	for _, line := range lines {
-		m.addLog(line)
+func (m *model) addText(s string, style ansiesc.Style) {
+	for _, text := range strings.Split(s, "\n") {
+		m.addLine(line{{text: text, style: style}})
 	}
 }
 
-func (m *model) addLog(s string) {
-	m.messages = append(m.messages, s)
+func (m *model) addLine(l line) {
+	m.messages = append(m.messages, l)
 }
 
 type Program struct {
@@ -94,23 +100,47 @@ type Program struct {
 	old            *term.State
 	fd             int
 	writer         *termout.Writer
+	screen         *termout.Screen
 	logger         *log.Logger
 	cancel         context.CancelFunc
 	model          *model
 	box            *inputBox
 	logs           *logs
-	home           string
-	openConfig     string
-	sessionConfig  string
-	cursorConfig   string
-	uri            string
+	startup        []string
 	commandHandler func(s string)
+	termMu         sync.Mutex
+	restored       bool
+	lastError      string
+	theme          Theme
+	browser        *browseView
 }
 
 type model struct {
 	height   int
 	width    int
-	messages []string
+	messages []line
+	home     string
+	readOnly bool
+	status   wtshmsg.StatusMessage
+	// bench is the last progress of a running bench, cleared by the status
+	// sent once the command is done
+	bench *wtshmsg.BenchProgressMessage
+}
+
+func (m *model) prompt() string {
+	var b strings.Builder
+
+	if m.readOnly {
+		b.WriteString("[ro]")
+	}
+
+	if m.home != "" {
+		fmt.Fprintf(&b, "[%s]", m.home)
+	}
+
+	b.WriteString("$ ")
+
+	return b.String()
 }
 
 func (p *Program) Input(events []termin.Event) {
@@ -121,6 +151,22 @@ func (p *Program) Input(events []termin.Event) {
 				p.inputKey(v)
 
 			}
+
+			if p.browser != nil {
+				if p.browser.Update(e) {
+					p.browser = nil
+				}
+
+				continue
+			}
+
+			switch e.(type) {
+			case termin.MousePress, termin.MouseMotion, termin.MouseRelease:
+				if text, ok := p.logs.update(e, p.model, p.logSpace()); ok {
+					p.copy(text)
+				}
+			}
+
 			p.box.Update(e, p.model)
 		}
 
@@ -128,15 +174,48 @@ func (p *Program) Input(events []termin.Event) {
 	}
 }
 
+// logSpace is the number of rows above the bench view, status bar and
+// input box.
+func (p *Program) logSpace() int {
+	return max(p.model.height-p.box.height(p.model.width)-1-len(p.benchLines()), 0)
+}
+
+func (p *Program) renderStatus() {
+	// the input box can take up the whole screen
+	row := p.model.height - p.box.height(p.model.width) - 1
+	if row < 0 {
+		return
+	}
+
+	text := " " + strings.Join(p.model.status.Segments(), " │ ")
+	text += strings.Repeat(" ", max(p.screen.Width()-utf8.RuneCountInString(text), 0))
+
+	p.screen.WriteStyled(row, 0, text, p.theme.Status)
+}
+
 func (p *Program) render() {
-	s := screen{
-		buffer: os.Stdout,
-		height: p.model.height,
-		width:  p.model.width,
+	p.screen.Clear()
+
+	if p.browser != nil {
+		p.browser.render(p.screen)
+	} else {
+		p.logs.render(p.screen, p.model, p.logSpace())
+		p.renderBench()
+		p.renderStatus()
+		p.box.render(p.screen)
 	}
 
-	p.logs.render(s, p.model)
-	p.box.render(s)
+	p.termMu.Lock()
+	defer p.termMu.Unlock()
+
+	// a late frame must not land on the restored main screen
+	if p.restored {
+		return
+	}
+
+	if err := p.screen.Flush(); err != nil {
+		p.logger.Println(fmt.Errorf("flush screen: %w", err))
+	}
 }
 
 type inputBox struct {
@@ -148,21 +227,47 @@ type inputBox struct {
 	history      []string
 	historyIndex int
 	logger       *log.Logger
+	theme        Theme
+	// pasted holds a multi-line paste until it is confirmed or dropped
+	pasted string
 }
 
-func newInputbox(logger *log.Logger, submit func(p, s string)) *inputBox {
+func newInputbox(logger *log.Logger, theme Theme, submit func(p, s string)) *inputBox {
 	return &inputBox{
 		index:   0,
 		prompt:  "$ ",
 		Content: "",
 		logger:  logger,
+		theme:   theme,
 		submit:  submit,
 		history: make([]string, 0, 10),
 	}
 }
 
 func (b *inputBox) Update(e termin.Event, m *model) {
+	if b.pasted != "" {
+		if k, ok := e.(termin.Key); ok {
+			if k.Type == termin.KeyCharacter && (k.Rune == 'y' || k.Rune == 'Y') {
+				b.submit(b.prompt, b.pasted)
+			}
+
+			b.pasted = ""
+		}
+
+		return
+	}
+
 	switch v := e.(type) {
+	case termin.Paste:
+		text := strings.TrimRight(v.Text, "\n")
+
+		if strings.Contains(text, "\n") {
+			b.pasted = text
+			break
+		}
+
+		b.Content = b.Content[:b.index] + text + b.Content[b.index:]
+		b.index += len(text)
 	case termin.Key:
 		switch v.Type {
 		case termin.KeyEnter:
@@ -212,11 +317,7 @@ func (b *inputBox) Update(e termin.Event, m *model) {
 			}
 		case termin.KeyCharacter:
 			b.Content = b.Content[:b.index] + string(v.Rune) + b.Content[b.index:]
-			if len(b.Content)+len(b.prompt) > m.width {
-				b.Content = b.Content[:m.width]
-			} else {
-				b.index++
-			}
+			b.index++
 		case termin.KeyBackspace:
 			if b.index == 0 {
 				break
@@ -225,17 +326,69 @@ func (b *inputBox) Update(e termin.Event, m *model) {
 			b.Content = b.Content[:b.index-1] + b.Content[b.index:]
 			b.index--
 		}
+	case termin.MousePress:
+		rows := min(b.height(m.width), m.height)
+		if v.Key != termin.MouseLeft || v.Point.Y < m.height-rows {
+			break
+		}
+
+		// move the edit cursor to the clicked character
+		skipped := b.height(m.width) - rows
+		column := (v.Point.Y-(m.height-rows)+skipped)*m.width + v.Point.X - utf8.RuneCountInString(b.prompt)
+		b.index = len(b.Content)
+
+		for i := range b.Content {
+			if column <= 0 {
+				b.index = i
+				break
+			}
+
+			column--
+		}
 	}
 }
 
-type screen struct {
-	buffer io.Writer
-	height int
-	width  int
+// height is the number of rows the prompt and content wrap onto, leaving
+// room for the cursor after the last character.
+func (b *inputBox) height(width int) int {
+	if b.pasted != "" || width <= 0 {
+		return 1
+	}
+
+	n := utf8.RuneCountInString(b.prompt) + utf8.RuneCountInString(b.Content) + 1
+
+	return (n + width - 1) / width
 }
 
-func (b *inputBox) render(s screen) {
-	fmt.Fprint(s.buffer, ansiesc.SetPosition(s.height, 0)+ansiesc.ClearToEndOfLine()+b.prompt+b.Content+ansiesc.SetPosition(s.height, b.index+utf8.RuneCountInString(b.prompt)))
+func (b *inputBox) render(s *termout.Screen) {
+	if b.pasted != "" {
+		row := s.Height() - 1
+		n := strings.Count(b.pasted, "\n") + 1
+		column := s.WriteStyled(row, 0, fmt.Sprintf("run %d pasted lines as a script? [y/N] ", n), b.theme.Prompt)
+		s.SetCursor(row, column)
+		s.ShowCursor(true)
+
+		return
+	}
+
+	width := max(s.Width(), 1)
+
+	// when the content is taller than the screen, keep its end visible
+	rows := min(b.height(width), s.Height())
+	top := s.Height() - rows
+	skipped := b.height(width) - rows
+
+	wrapped := append(line{{text: b.prompt, style: b.theme.Prompt}}, highlight(b.Content, b.theme)...).wrap(width)
+	for i := skipped; i < len(wrapped); i++ {
+		column := 0
+		for _, sp := range wrapped[i] {
+			column = s.WriteStyled(top+i-skipped, column, sp.text, sp.style)
+		}
+	}
+
+	cursor := utf8.RuneCountInString(b.prompt) + utf8.RuneCountInString(b.Content[:b.index])
+	s.SetCursor(top+cursor/width-skipped, cursor%width)
+	s.ShowCursor(true)
 }
 
 func (p *Program) Quit() {
@@ -255,6 +408,7 @@ func (p *Program) Resize(w, h int) {
 	p.actions <- func() {
 		p.model.height = h
 		p.model.width = w
+		p.screen.Resize(w, h)
 		p.invalidate()
 	}
 }
@@ -263,27 +417,71 @@ func (p *Program) HandleMessage(m any) {
 	p.actions <- func() {
 		switch v := m.(type) {
 		case error:
-			p.model.addLog(v.Error())
+			p.model.addText(v.Error(), p.theme.Error)
+			p.lastError = v.Error()
+
+			if p.browser != nil {
+				p.browser.pending = false
+				p.browser.status = v.Error()
+			}
 		case string:
-			p.model.addLog(v)
+			p.model.addText(v, ansiesc.Style{})
 		case wtshmsg.DatabaseConnectedMessage:
-			p.model.addLog(v.String())
-			p.box.prompt = fmt.Sprintf("[%s]$ ", v.Home)
+			p.model.addText(v.String(), p.theme.Success)
+			p.model.home = v.Home
+			p.box.prompt = p.model.prompt()
 		case wtshmsg.DatabaseDisconnectedMessage:
-			p.model.addLog(v.String())
-			p.box.prompt = "$ "
+			p.model.addText(v.String(), p.theme.Success)
+			p.model.home = ""
+			p.box.prompt = p.model.prompt()
+		case wtshmsg.ReadOnlyMessage:
+			p.model.addText(v.String(), p.theme.Success)
+			p.model.readOnly = true
+			p.box.prompt = p.model.prompt()
 		case wtshmsg.NewSessionMessage:
-			p.model.addLog(v.String())
+			p.model.addText(v.String(), p.theme.Success)
+		case wtshmsg.ClosedSessionMessage:
+			p.model.addText(v.String(), p.theme.Success)
+		case wtshmsg.TransactionMessage:
+			p.model.addText(v.String(), p.theme.Success)
+		case wtshmsg.BackupFileMessage:
+			p.model.addText(v.String(), p.theme.Echo)
+		case wtshmsg.BackupMessage:
+			p.model.addText(v.String(), p.theme.Success)
+		case wtshmsg.ProfileMessage:
+			p.model.addText(v.String(), p.theme.Echo)
+		case wtshmsg.GenerateProgressMessage:
+			p.model.addText(v.String(), p.theme.Echo)
+		case wtshmsg.GenerateMessage:
+			p.model.addText(v.String(), p.theme.Success)
+		case wtshmsg.DiffMessage:
+			p.model.addText(v.String(), p.theme.Success)
+		case wtshmsg.BenchProgressMessage:
+			p.model.bench = &v
+		case wtshmsg.StatusMessage:
+			p.model.status = v
+			p.model.bench = nil
 		case wtshmsg.ClosedCursorMessage:
-			p.model.addLog(v.String())
+			p.model.addText(v.String(), p.theme.Success)
 		case wtshmsg.NewCursorMessage:
-			p.model.addLog(v.String())
+			p.model.addText(v.String(), p.theme.Success)
 		case wtshmsg.CreateMessage:
-			p.model.addLog(v.String())
+			p.model.addText(v.String(), p.theme.Success)
+		case wtshmsg.ScriptCommandMessage:
+			p.model.addLine(line{{text: p.box.prompt + v.String(), style: p.theme.Echo}})
 		case wtshmsg.ResultMessage:
-			p.model.addLogSplit(v.String())
+			for _, l := range resultLines(v, p.theme) {
+				p.model.addLine(l)
+			}
 		case wtshmsg.DropMessage:
-			p.model.addLog(v.String())
+			p.model.addText(v.String(), p.theme.Success)
+		case wtshmsg.BrowseOpenMessage:
+			p.model.addText(v.String(), p.theme.Success)
+			p.browser = newBrowseView(v, p.commandHandler, p.theme)
+		case wtshmsg.BrowsePageMessage:
+			if p.browser != nil {
+				p.browser.page(v)
+			}
 		}
 
 		p.invalidate()
@@ -299,36 +497,63 @@ func (p *Program) invalidate() {
 	}
 }
 
+// copy puts text on the system clipboard through the terminal.
+func (p *Program) copy(text string) {
+	p.termMu.Lock()
+	defer p.termMu.Unlock()
+
+	if p.restored {
+		return
+	}
+
+	if _, err := p.writer.WriteString(ansiesc.CopyToClipboard(text)); err != nil {
+		p.logger.Println(fmt.Errorf("copy to clipboard: %w", err))
+	}
+}
+
+// Reset restores the main screen and the original terminal state. It is safe
+// to call more than once and from any goroutine, e.g. from a signal handler
+// while the render loop is still running.
 func (p *Program) Reset() {
-	fmt.Print(ansiesc.DisableMouse() + ansiesc.ClearScreen() + ansiesc.ShowCursor() + ansiesc.SetPosition(0, 0))
+	p.termMu.Lock()
+	defer p.termMu.Unlock()
+
+	if p.restored {
+		return
+	}
+
+	p.restored = true
+
+	p.writer.WriteString(ansiesc.EndSynchronizedUpdate() + ansiesc.DisableBracketedPaste() + ansiesc.DisableMouse() + ansiesc.ShowCursor() + ansiesc.ExitAlternateScreen())
 	term.Restore(p.fd, p.old)
 	p.logger.Println("RESET")
 }
 
-func (p *Program) Run(ctx context.Context) error {
-	fmt.Print(ansiesc.ClearScreen() + ansiesc.EnableMouse())
+// Summary describes the session for printing after Reset, or returns "" if
+// there is nothing worth reporting. Only call it once Run has returned.
+func (p *Program) Summary() string {
+	if p.lastError == "" {
+		return ""
+	}
 
-	done := ctx.Done()
+	return fmt.Sprintf("last error: %s", p.lastError)
+}
 
-	if p.home != "" {
-		cmd := fmt.Sprintf("open %s %s %s", p.home, p.openConfig, p.sessionConfig)
-		p.commandHandler(cmd)
+func (p *Program) Run(ctx context.Context) error {
+	p.writer.WriteString(ansiesc.EnterAlternateScreen() + ansiesc.EnableMouse() + ansiesc.EnableBracketedPaste())
 
-		cmd = "open-session"
-		if p.sessionConfig != "" {
-			cmd += " " + p.sessionConfig
-		}
-		p.commandHandler(cmd)
+	// a panic while rendering must not leave the terminal raw
+	defer p.Reset()
 
-		if p.uri != "" {
-			cmd = fmt.Sprintf("open-cursor %s", p.uri)
-			if p.cursorConfig != "" {
-				cmd += " " + p.cursorConfig
-			}
+	done := ctx.Done()
 
+	// the executor reports back through p.actions, so queue the startup
+	// commands without blocking the loop that drains it
+	go func(cmds []string) {
+		for _, cmd := range cmds {
 			p.commandHandler(cmd)
 		}
-	}
+	}(p.startup)
 
 	for {
 		select {
@@ -349,23 +574,226 @@ func (p *Program) Run(ctx context.Context) error {
 	}
 }
 
+// position is a character in the log, as an index into model.messages and
+// a column within that line.
+type position struct {
+	line   int
+	column int
+}
+
+func (p position) before(o position) bool {
+	return p.line < o.line || (p.line == o.line && p.column < o.column)
+}
+
 type logs struct {
-	w *termout.Writer
+	// the selection runs from anchor to head inclusive, in either order
+	anchor    position
+	head      position
+	selecting bool
+	selected  bool
+}
+
+func newLogs() *logs {
+	return &logs{}
+}
+
+// row is one screen row of the log, holding part of a message starting
+// offset characters in.
+type row struct {
+	line   int
+	offset int
+	spans  line
+}
+
+// layout wraps the newest messages to width and returns up to height rows
+// of them, top to bottom. Wrapping happens on every render so a resize
+// reflows the whole log.
+func layout(messages []line, width, height int) []row {
+	rows := make([]row, 0, height)
+
+	for n := len(messages) - 1; n >= 0 && len(rows) < height; n-- {
+		wrapped := messages[n].wrap(width)
+
+		for i := len(wrapped) - 1; i >= 0 && len(rows) < height; i-- {
+			rows = append(rows, row{line: n, offset: i * width, spans: wrapped[i]})
+		}
+	}
+
+	slices.Reverse(rows)
+
+	return rows
+}
+
+func (l *logs) render(s *termout.Screen, m *model, space int) {
+	rows := layout(m.messages, s.Width(), space)
+	top := space - len(rows)
+
+	for i, r := range rows {
+		column := 0
+		for _, sp := range r.spans {
+			column = s.WriteStyled(top+i, column, sp.text, sp.style)
+		}
+	}
+
+	if !l.selected {
+		return
+	}
+
+	start, end := l.bounds()
+
+	for i, r := range rows {
+		if r.line < start.line || r.line > end.line {
+			continue
+		}
+
+		from, to := 0, s.Width()
+
+		if r.line == start.line {
+			from = start.column - r.offset
+		}
+
+		if r.line == end.line {
+			to = end.column + 1 - r.offset
+		}
+
+		s.Reverse(top+i, from, to)
+	}
 }
 
-func newLogs(w *termout.Writer) *logs {
-	return &logs{
-		w: w,
+func (l *logs) bounds() (position, position) {
+	if l.head.before(l.anchor) {
+		return l.head, l.anchor
 	}
+
+	return l.anchor, l.head
 }
 
-func (l *logs) render(s screen, m *model) {
-	space := m.height - 1 // subtract 1 to leave space for input box
+// update tracks a selection dragged over the log with the left button, and
+// returns the selected text once the button is released.
+func (l *logs) update(e termin.Event, m *model, space int) (string, bool) {
+	rows := layout(m.messages, m.width, space)
 
-	for i, n := 0, len(m.messages)-1; i < space && n > -1; i, n = i+1, n-1 {
-		line := m.messages[n]
-		l.w.SetCursor(space-(i+1), 0)
-		l.w.ClearLine()
-		l.w.WriteString(line)
+	at := func(p termin.Point) position {
+		if len(rows) == 0 {
+			return position{}
+		}
+
+		r := rows[min(max(p.Y-(space-len(rows)), 0), len(rows)-1)]
+
+		return position{line: r.line, column: r.offset + min(max(p.X, 0), max(m.width-1, 0))}
 	}
+
+	switch v := e.(type) {
+	case termin.MousePress:
+		l.selected = false
+		l.selecting = v.Key == termin.MouseLeft && v.Point.Y < space
+
+		if l.selecting {
+			l.anchor = at(v.Point)
+			l.head = l.anchor
+		}
+	case termin.MouseMotion:
+		if l.selecting {
+			l.head = at(v.Point)
+			l.selected = true
+		}
+	case termin.MouseRelease:
+		if !l.selecting {
+			break
+		}
+
+		l.selecting = false
+
+		if l.selected {
+			return l.text(m), true
+		}
+	}
+
+	return "", false
+}
+
+func (l *logs) text(m *model) string {
+	start, end := l.bounds()
+	lines := make([]string, 0, end.line-start.line+1)
+
+	for line := max(start.line, 0); line <= end.line && line < len(m.messages); line++ {
+		r := []rune(m.messages[line].String())
+		from, to := 0, len(r)
+
+		if line == start.line {
+			from = min(start.column, len(r))
+		}
+
+		if line == end.line {
+			to = min(end.column+1, len(r))
+		}
+
+		lines = append(lines, strings.TrimRight(string(r[from:max(from, to)]), " "))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// resultLines lays out a result as a grid with a header and a footer,
+// styling key columns and value columns separately.
+func resultLines(m wtshmsg.ResultMessage, t Theme) []line {
+	widths := m.Widths()
+	numeric := make([]bool, len(widths))
+
+	for i := range widths {
+		numeric[i] = m.Numeric(i)
+	}
+
+	separator := span{text: " │ ", style: t.Echo}
+
+	lines := make([]line, 0, len(m.Rows)+3)
+
+	if len(m.Columns) > 0 {
+		header := make(line, 0, 2*len(widths))
+		rule := make([]string, len(widths))
+
+		for i, w := range widths {
+			if i > 0 {
+				header = append(header, separator)
+			}
+
+			name := ""
+			if i < len(m.Columns) {
+				name = m.Columns[i].Name
+			}
+
+			header = append(header, span{text: wtshmsg.Align(name, w, numeric[i]), style: t.Header})
+			rule[i] = strings.Repeat("─", w)
+		}
+
+		lines = append(lines, header, line{{text: strings.Join(rule, "─┼─"), style: t.Echo}})
+	}
+
+	for _, cells := range m.Rows {
+		for _, row := range wtshmsg.SplitRow(cells) {
+			l := make(line, 0, 2*len(widths))
+
+			for i, w := range widths {
+				if i > 0 {
+					l = append(l, separator)
+				}
+
+				cell := ""
+				if i < len(row) {
+					cell = row[i]
+				}
+
+				style := t.Value
+				if i < m.Keys {
+					style = t.Key
+				}
+
+				l = append(l, span{text: wtshmsg.Align(cell, w, numeric[i]), style: style})
+			}
+
+			lines = append(lines, l)
+		}
+	}
+
+	return append(lines, line{{text: m.Footer(), style: t.Echo}})
 }
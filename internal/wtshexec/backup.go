@@ -0,0 +1,140 @@
+package wtshexec
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"wtsh/internal/wtshmsg"
+)
+
+const backupUsage = "parse: backup <dest-dir> [--log-only]"
+
+// backup implements backup <dest-dir> [--log-only]. Incremental backups
+// aren't supported: the changed ranges of each file are listed by a duplicate
+// backup cursor, which wtgo can't open, so --incremental and --this-id are
+// refused rather than copying whole files or tracking changes nothing reads.
+func (r *ConnectionHandler) backup(args string) error {
+	fields := strings.Fields(args)
+
+	var dest string
+	var logOnly bool
+
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "--incremental", "--src-id", "--this-id":
+			return fmt.Errorf("backup: incremental backups need duplicate backup cursors, which wtgo can't open")
+		case "--log-only":
+			logOnly = true
+		default:
+			if strings.HasPrefix(fields[i], "--") {
+				return fmt.Errorf("parse: unknown option '%s'", fields[i])
+			}
+
+			if dest != "" {
+				return fmt.Errorf(backupUsage)
+			}
+
+			dest = fields[i]
+		}
+	}
+
+	if dest == "" {
+		return fmt.Errorf(backupUsage)
+	}
+
+	var config string
+
+	if logOnly {
+		config = `target=("log:")`
+	}
+
+	// a full backup has to start from nothing, while a log backup adds to an
+	// earlier one
+	if !logOnly {
+		if entries, err := os.ReadDir(dest); err == nil && len(entries) > 0 {
+			return fmt.Errorf("backup: '%s' is not empty", dest)
+		}
+	}
+
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+
+	cursor, err := r.state.session.OpenCursor("backup:", config)
+	if err != nil {
+		return fmt.Errorf("open backup cursor: %w", err)
+	}
+	defer cursor.Close()
+
+	// files are only guaranteed to stay put while the cursor is open, so
+	// list them all and copy before closing it
+	files := make([]string, 0, 16)
+
+	for cursor.Next() {
+		rec, err := r.readRecord(cursor)
+		if err != nil {
+			return fmt.Errorf("backup: %w", err)
+		}
+
+		name, ok := rec.Key[0].(string)
+		if !ok {
+			return fmt.Errorf("backup: unexpected key %v", rec.Key[0])
+		}
+
+		files = append(files, name)
+	}
+
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+
+	var total int64
+
+	for i, name := range files {
+		n, err := copyFile(filepath.Join(r.state.home, name), filepath.Join(dest, name))
+		if err != nil {
+			return fmt.Errorf("backup: %s: %w", name, err)
+		}
+
+		total += n
+
+		r.handler.HandleMessage(wtshmsg.BackupFileMessage{File: name, Bytes: n, Index: i + 1, Count: len(files)})
+	}
+
+	r.handler.HandleMessage(wtshmsg.BackupMessage{
+		Dest:    dest,
+		Files:   len(files),
+		Bytes:   total,
+		LogOnly: logOnly,
+	})
+
+	return nil
+}
+
+// copyFile copies src over dst and syncs it, returning the bytes written.
+func copyFile(src, dst string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return 0, err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+
+	return n, errors.Join(err, out.Close())
+}
@@ -0,0 +1,624 @@
+package wtshexec
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"math/rand"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"wtsh/internal/wtshmsg"
+
+	"github.com/dylrich/wtgo"
+)
+
+const benchUsage = "parse: bench <uri> [--ops insert:50,search:40,remove:10] [--threads n] [--duration 10s] [--key-dist zipf|uniform] [--value-size n] [--keys n]"
+
+var benchOps = []string{"insert", "update", "search", "remove"}
+
+type benchConfig struct {
+	uri       string
+	weights   map[string]int
+	threads   int
+	duration  time.Duration
+	zipf      bool
+	valueSize int
+	keys      uint64
+}
+
+func parseBench(args string) (benchConfig, error) {
+	fields := strings.Fields(args)
+
+	if len(fields) == 0 {
+		return benchConfig{}, fmt.Errorf(benchUsage)
+	}
+
+	c := benchConfig{
+		uri:       fields[0],
+		weights:   map[string]int{"insert": 50, "search": 40, "remove": 10},
+		threads:   4,
+		duration:  10 * time.Second,
+		valueSize: 100,
+		keys:      100000,
+	}
+
+	for i := 1; i < len(fields); i++ {
+		if i+1 >= len(fields) {
+			return c, fmt.Errorf("parse: %s requires a value", fields[i])
+		}
+
+		v := fields[i+1]
+
+		var err error
+
+		switch fields[i] {
+		case "--ops":
+			c.weights, err = parseBenchOps(v)
+		case "--threads":
+			c.threads, err = strconv.Atoi(v)
+			if err == nil && c.threads < 1 {
+				err = fmt.Errorf("must be at least 1")
+			}
+		case "--duration":
+			c.duration, err = time.ParseDuration(v)
+		case "--key-dist":
+			switch v {
+			case "zipf":
+				c.zipf = true
+			case "uniform":
+				c.zipf = false
+			default:
+				err = fmt.Errorf("expected zipf or uniform")
+			}
+		case "--value-size":
+			c.valueSize, err = strconv.Atoi(v)
+			if err == nil && c.valueSize < 0 {
+				err = fmt.Errorf("must not be negative")
+			}
+		case "--keys":
+			c.keys, err = strconv.ParseUint(v, 10, 64)
+			if err == nil && c.keys < 1 {
+				err = fmt.Errorf("must be at least 1")
+			}
+		default:
+			return c, fmt.Errorf("parse: unknown option '%s'", fields[i])
+		}
+
+		if err != nil {
+			return c, fmt.Errorf("parse: %s: %w", fields[i], err)
+		}
+
+		i++
+	}
+
+	return c, nil
+}
+
+func parseBenchOps(s string) (map[string]int, error) {
+	weights := make(map[string]int)
+
+	for _, op := range strings.Split(s, ",") {
+		name, weight, ok := strings.Cut(op, ":")
+		if !ok {
+			return nil, fmt.Errorf("'%s' is not <op>:<weight>", op)
+		}
+
+		if !slices.Contains(benchOps, name) {
+			return nil, fmt.Errorf("'%s' is not an operation, expected %s", name, strings.Join(benchOps, ", "))
+		}
+
+		n, err := strconv.Atoi(weight)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("'%s' is not a valid weight", weight)
+		}
+
+		weights[name] = n
+	}
+
+	return weights, nil
+}
+
+// bench implements the bench command, running a weighted mix of operations
+// on uri from several goroutines, each with its own session, and reporting
+// throughput and latency every second until the duration is up.
+func (r *ConnectionHandler) bench(args string) error {
+	c, err := parseBench(args)
+	if err != nil {
+		return err
+	}
+
+	total := 0
+	for _, w := range c.weights {
+		total += w
+	}
+
+	if total == 0 {
+		return fmt.Errorf("bench: no operations to run")
+	}
+
+	if r.readOnly && c.weights["insert"]+c.weights["update"]+c.weights["remove"] > 0 {
+		return fmt.Errorf("bench: only search is allowed in read-only mode")
+	}
+
+	sch, err := r.schema(c.uri)
+	if err != nil {
+		return fmt.Errorf("bench: %w", err)
+	}
+
+	if len(sch.keyFormat) != 1 || len(sch.valueFormat) != 1 {
+		return fmt.Errorf("bench: '%s' needs a single key and value column", c.uri)
+	}
+
+	if _, err := benchKey(sch.keyFormat[0], 0); err != nil {
+		return fmt.Errorf("bench: %w", err)
+	}
+
+	if sch.valueFormat[0] != 'S' && sch.valueFormat[0] != 'u' {
+		return fmt.Errorf("bench: value format '%c' is not supported, expected S or u", sch.valueFormat[0])
+	}
+
+	workers := make([]*benchWorker, c.threads)
+
+	for i := range workers {
+		session, err := r.state.conn.OpenSession("")
+		if err != nil {
+			return fmt.Errorf("bench: open session: %w", err)
+		}
+		defer session.Close("")
+
+		cursor, err := session.OpenCursor(c.uri, "")
+		if err != nil {
+			return fmt.Errorf("bench: open cursor: %w", err)
+		}
+
+		workers[i] = newBenchWorker(c, sch, cursor, int64(i))
+	}
+
+	start := time.Now()
+	deadline := start.Add(c.duration)
+
+	var wg sync.WaitGroup
+
+	stop := make(chan struct{})
+
+	for _, w := range workers {
+		wg.Add(1)
+
+		go func(w *benchWorker) {
+			defer wg.Done()
+			w.run(deadline, total, stop)
+		}(w)
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	last := start
+	interrupted := false
+
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		case <-r.done:
+			// shutting down, so don't hold it up until the deadline
+			close(stop)
+			<-done
+
+			interrupted, running = true, false
+		case now := <-ticker.C:
+			interval := make(map[string]*histogram)
+
+			for _, w := range workers {
+				w.drain(interval)
+			}
+
+			r.handler.HandleMessage(benchProgress(c, now.Sub(start), now.Sub(last), interval))
+
+			last = now
+		}
+	}
+
+	elapsed := time.Since(start)
+
+	totals := make(map[string]*histogram)
+	errs := make(map[string]int64)
+
+	for _, w := range workers {
+		if err := w.cursor.Close(); err != nil {
+			r.logger.Printf("bench: close cursor: %s\n", err)
+		}
+
+		for op, h := range w.total {
+			merge(totals, op, h)
+			errs[op] += w.errors[op]
+		}
+
+		if w.err != nil {
+			r.logger.Printf("bench: %s\n", w.err)
+		}
+	}
+
+	if interrupted {
+		return fmt.Errorf("bench: interrupted after %.1fs", elapsed.Seconds())
+	}
+
+	r.handler.HandleMessage(benchSummary(c, elapsed, totals, errs))
+
+	return nil
+}
+
+type benchWorker struct {
+	config    benchConfig
+	keyFormat byte
+	value     any
+	cursor    *wtgo.Cursor
+	rng       *rand.Rand
+	zipf      *rand.Zipf
+
+	mu       sync.Mutex
+	interval map[string]*histogram
+
+	// only read once the worker is done
+	total  map[string]*histogram
+	errors map[string]int64
+	err    error
+}
+
+func newBenchWorker(c benchConfig, sch schema, cursor *wtgo.Cursor, seed int64) *benchWorker {
+	rng := rand.New(rand.NewSource(time.Now().UnixNano() + seed))
+
+	value := make([]byte, c.valueSize)
+	for i := range value {
+		value[i] = byte('a' + rng.Intn(26))
+	}
+
+	w := &benchWorker{
+		config:    c,
+		keyFormat: sch.keyFormat[0],
+		value:     value,
+		cursor:    cursor,
+		rng:       rng,
+		interval:  make(map[string]*histogram),
+		total:     make(map[string]*histogram),
+		errors:    make(map[string]int64),
+	}
+
+	if sch.valueFormat[0] == 'S' {
+		w.value = string(value)
+	}
+
+	if c.zipf {
+		w.zipf = rand.NewZipf(rng, 1.1, 1, c.keys-1)
+	}
+
+	return w
+}
+
+func (w *benchWorker) run(deadline time.Time, total int, stop <-chan struct{}) {
+	for time.Now().Before(deadline) {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		pick := w.rng.Intn(total)
+
+		var op string
+
+		for _, name := range benchOps {
+			if pick < w.config.weights[name] {
+				op = name
+				break
+			}
+
+			pick -= w.config.weights[name]
+		}
+
+		var n uint64
+		if w.zipf != nil {
+			n = w.zipf.Uint64()
+		} else {
+			n = uint64(w.rng.Int63n(int64(w.config.keys)))
+		}
+
+		key, _ := benchKey(w.keyFormat, n)
+
+		start := time.Now()
+		err := w.do(op, key)
+		elapsed := time.Since(start)
+
+		w.mu.Lock()
+
+		if err != nil && !errors.Is(err, wtgo.ErrNotFound) {
+			w.errors[op]++
+			w.err = err
+		}
+
+		observe(w.interval, op, elapsed)
+		observe(w.total, op, elapsed)
+
+		w.mu.Unlock()
+	}
+}
+
+// do runs one operation. wtgo keeps appending to the key it was given until
+// the cursor is reset, so every path ends with the key cleared.
+func (w *benchWorker) do(op string, key any) error {
+	if err := w.cursor.SetKey(key); err != nil {
+		return err
+	}
+
+	var err error
+
+	switch op {
+	case "insert", "update":
+		if err = w.cursor.SetValue(w.value); err != nil {
+			break
+		}
+
+		if op == "insert" {
+			err = w.cursor.Insert()
+		} else {
+			err = w.cursor.Update()
+		}
+	case "search":
+		err = w.cursor.Search()
+	case "remove":
+		err = w.cursor.Remove()
+	}
+
+	if rerr := w.cursor.Reset(); err == nil {
+		err = rerr
+	}
+
+	return err
+}
+
+// drain moves the latencies recorded since the last call into into.
+func (w *benchWorker) drain(into map[string]*histogram) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for op, h := range w.interval {
+		merge(into, op, h)
+	}
+
+	w.interval = make(map[string]*histogram)
+}
+
+func benchKey(format byte, n uint64) (any, error) {
+	switch format {
+	case 'S':
+		return fmt.Sprintf("key%012d", n), nil
+	case 'u':
+		return []byte(fmt.Sprintf("key%012d", n)), nil
+	case 'q':
+		return int64(n), nil
+	case 'Q':
+		return n, nil
+	case 'r':
+		// record numbers start at 1
+		return n + 1, nil
+	case 'i':
+		return int32(n), nil
+	case 'I':
+		return uint32(n), nil
+	}
+
+	return nil, fmt.Errorf("key format '%c' is not supported", format)
+}
+
+func benchProgress(c benchConfig, elapsed, interval time.Duration, ops map[string]*histogram) wtshmsg.BenchProgressMessage {
+	m := wtshmsg.BenchProgressMessage{URI: c.uri, Elapsed: elapsed, Duration: c.duration}
+
+	all := &histogram{}
+
+	for _, name := range benchOps {
+		h, ok := ops[name]
+		if !ok {
+			continue
+		}
+
+		all.add(h)
+
+		m.Ops = append(m.Ops, wtshmsg.BenchOp{
+			Name: name,
+			Ops:  h.count,
+			P50:  h.percentile(0.5),
+			P99:  h.percentile(0.99),
+		})
+	}
+
+	if interval > 0 {
+		m.Throughput = float64(all.count) / interval.Seconds()
+	}
+
+	m.Histogram = all.buckets()
+
+	return m
+}
+
+func benchSummary(c benchConfig, elapsed time.Duration, ops map[string]*histogram, errs map[string]int64) wtshmsg.ResultMessage {
+	columns := []wtshmsg.Column{
+		{Name: "op", Type: "S"},
+		{Name: "ops", Type: "q"},
+		{Name: "ops/s", Type: "q"},
+		{Name: "errors", Type: "q"},
+		{Name: "mean", Type: "S"},
+		{Name: "p50", Type: "S"},
+		{Name: "p90", Type: "S"},
+		{Name: "p99", Type: "S"},
+		{Name: "p99.9", Type: "S"},
+		{Name: "max", Type: "S"},
+	}
+
+	rows := make([][]string, 0, len(ops))
+
+	for _, name := range benchOps {
+		h, ok := ops[name]
+		if !ok {
+			continue
+		}
+
+		rows = append(rows, []string{
+			name,
+			strconv.FormatInt(h.count, 10),
+			strconv.FormatInt(int64(float64(h.count)/elapsed.Seconds()), 10),
+			strconv.FormatInt(errs[name], 10),
+			wtshmsg.FormatLatency(h.mean()),
+			wtshmsg.FormatLatency(h.percentile(0.5)),
+			wtshmsg.FormatLatency(h.percentile(0.9)),
+			wtshmsg.FormatLatency(h.percentile(0.99)),
+			wtshmsg.FormatLatency(h.percentile(0.999)),
+			wtshmsg.FormatLatency(h.max),
+		})
+	}
+
+	return wtshmsg.ResultMessage{Columns: columns, Rows: rows, Keys: 1, Elapsed: elapsed}
+}
+
+// histogramSub is the number of buckets each power of two is split into,
+// which bounds the error of a percentile to about 6%.
+const histogramSub = 16
+
+// histogram counts latencies in log-linear buckets of nanoseconds.
+type histogram struct {
+	counts [64 * histogramSub]int64
+	count  int64
+	sum    time.Duration
+	max    time.Duration
+}
+
+func observe(hs map[string]*histogram, op string, d time.Duration) {
+	h, ok := hs[op]
+	if !ok {
+		h = &histogram{}
+		hs[op] = h
+	}
+
+	h.counts[bucketOf(d)]++
+	h.count++
+	h.sum += d
+	h.max = max(h.max, d)
+}
+
+func merge(hs map[string]*histogram, op string, from *histogram) {
+	h, ok := hs[op]
+	if !ok {
+		h = &histogram{}
+		hs[op] = h
+	}
+
+	h.add(from)
+}
+
+func (h *histogram) add(o *histogram) {
+	for i, n := range o.counts {
+		h.counts[i] += n
+	}
+
+	h.count += o.count
+	h.sum += o.sum
+	h.max = max(h.max, o.max)
+}
+
+func bucketOf(d time.Duration) int {
+	n := uint64(max(d, 0))
+	if n < histogramSub {
+		return int(n)
+	}
+
+	// shift so the top five bits select one of 16 buckets in [16, 32)
+	e := bits.Len64(n) - 5
+
+	return (e+1)*histogramSub + int(n>>e) - histogramSub
+}
+
+// bucketValue is the middle of bucket i.
+func bucketValue(i int) time.Duration {
+	if i < histogramSub {
+		return time.Duration(i)
+	}
+
+	e := i/histogramSub - 1
+	low := uint64(histogramSub+i%histogramSub) << e
+
+	return time.Duration(low + (uint64(1)<<e)/2)
+}
+
+func (h *histogram) mean() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+
+	return h.sum / time.Duration(h.count)
+}
+
+func (h *histogram) percentile(p float64) time.Duration {
+	target := int64(p * float64(h.count))
+
+	var seen int64
+
+	for i, n := range h.counts {
+		seen += n
+
+		if seen > target {
+			return min(bucketValue(i), h.max)
+		}
+	}
+
+	return h.max
+}
+
+// buckets regroups the counts by powers of two microseconds, from the
+// fastest to the slowest latency seen.
+func (h *histogram) buckets() []wtshmsg.BenchBucket {
+	counts := make(map[time.Duration]int64)
+
+	for i, n := range h.counts {
+		if n == 0 {
+			continue
+		}
+
+		upper := time.Microsecond
+		for upper < bucketValue(i) {
+			upper *= 2
+		}
+
+		counts[upper] += n
+	}
+
+	uppers := make([]time.Duration, 0, len(counts))
+	for u := range counts {
+		uppers = append(uppers, u)
+	}
+
+	sort.Slice(uppers, func(i, j int) bool {
+		return uppers[i] < uppers[j]
+	})
+
+	buckets := make([]wtshmsg.BenchBucket, 0, len(uppers))
+
+	if len(uppers) == 0 {
+		return buckets
+	}
+
+	for u := uppers[0]; u <= uppers[len(uppers)-1]; u *= 2 {
+		buckets = append(buckets, wtshmsg.BenchBucket{Upper: u, Count: counts[u]})
+	}
+
+	return buckets
+}
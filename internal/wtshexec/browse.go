@@ -0,0 +1,307 @@
+package wtshexec
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"wtsh/internal/wtshmsg"
+
+	"github.com/dylrich/wtgo"
+)
+
+// browser backs the browse view with a cursor of its own. head and tail are
+// the keys of the first and last records the view has loaded, so pages can
+// be fetched in either direction without keeping the cursor in place.
+type browser struct {
+	uri    string
+	cursor *wtgo.Cursor
+	schema schema
+	head   []any
+	tail   []any
+}
+
+const defaultBrowsePage = 50
+
+func (r *ConnectionHandler) browse(args string) error {
+	uri := strings.TrimSpace(args)
+
+	if uri == "" || strings.Contains(uri, " ") {
+		return fmt.Errorf("parse: browse <uri>")
+	}
+
+	if r.state.browser != nil {
+		if err := r.closeBrowser(); err != nil {
+			return err
+		}
+	}
+
+	cursor, err := r.state.session.OpenCursor(uri, "")
+	if err != nil {
+		return fmt.Errorf("open cursor: %w", err)
+	}
+
+	sch, err := r.schema(uri)
+	if err != nil {
+		r.logger.Printf("no formats for '%s': %s\n", uri, err)
+	}
+
+	r.state.browser = &browser{uri: uri, cursor: cursor, schema: sch}
+
+	cols, keys := columns(nil, sch)
+
+	r.handler.HandleMessage(wtshmsg.BrowseOpenMessage{URI: uri, Columns: cols, Keys: keys})
+
+	return nil
+}
+
+func (r *ConnectionHandler) closeBrowser() error {
+	b := r.state.browser
+	r.state.browser = nil
+
+	if err := b.cursor.Close(); err != nil {
+		return fmt.Errorf("close browse cursor: %w", err)
+	}
+
+	return nil
+}
+
+// browseCommand runs the commands the browse view sends as it scrolls:
+// browse-next [n], browse-prev [n], browse-seek <key> and browse-close.
+func (r *ConnectionHandler) browseCommand(cmd, args string) error {
+	if r.state.browser == nil {
+		return fmt.Errorf("not browsing")
+	}
+
+	switch cmd {
+	case "browse-close":
+		return r.closeBrowser()
+	case "browse-seek":
+		key, err := convertFields(splitFields(args), r.state.browser.schema.keyFormat)
+		if err != nil {
+			return fmt.Errorf("key: %w", err)
+		}
+
+		return r.browseSeek(key)
+	}
+
+	n := defaultBrowsePage
+
+	if args != "" {
+		v, err := strconv.Atoi(args)
+		if err != nil || v < 1 {
+			return fmt.Errorf("parse: %s [count]", cmd)
+		}
+
+		n = v
+	}
+
+	return r.browsePage(cmd == "browse-prev", n)
+}
+
+func (r *ConnectionHandler) browsePage(prev bool, n int) error {
+	b := r.state.browser
+
+	step := b.cursor.Next
+	anchor := b.tail
+	if prev {
+		step = b.cursor.Prev
+		anchor = b.head
+	}
+
+	// wtgo appends to the key it was given last until the cursor is reset
+	if err := b.cursor.Reset(); err != nil {
+		return fmt.Errorf("reset: %w", err)
+	}
+
+	var ok bool
+
+	if anchor == nil {
+		ok = step()
+	} else {
+		if err := b.cursor.SetKey(anchor...); err != nil {
+			return fmt.Errorf("set key: %w", err)
+		}
+
+		// the anchor may have been removed since it was loaded
+		cmp, err := b.cursor.SearchNear()
+		switch {
+		case errors.Is(err, wtgo.ErrNotFound):
+			ok = false
+		case err != nil:
+			return fmt.Errorf("search near: %w", err)
+		case cmp == wtgo.CursorComparisonGreaterThan && !prev:
+			ok = true
+		case cmp == wtgo.CursorComparisonLessThan && prev:
+			ok = true
+		default:
+			ok = step()
+		}
+	}
+
+	records := make([]record, 0, n)
+
+	for ; ok; ok = step() {
+		rec, err := r.readRecord(b.cursor)
+		if err != nil {
+			return err
+		}
+
+		records = append(records, rec)
+
+		if len(records) == n {
+			break
+		}
+	}
+
+	if err := b.cursor.Err(); err != nil {
+		return fmt.Errorf("iteration: %w", err)
+	}
+
+	direction := wtshmsg.BrowseNext
+
+	if prev {
+		direction = wtshmsg.BrowsePrev
+
+		for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+			records[i], records[j] = records[j], records[i]
+		}
+	}
+
+	if len(records) > 0 {
+		if prev || b.head == nil {
+			b.head = records[0].Key
+		}
+
+		if !prev || b.tail == nil {
+			b.tail = records[len(records)-1].Key
+		}
+	}
+
+	r.sendPage(direction, records, !ok)
+
+	return nil
+}
+
+// browseSeek loads a page starting at the first record at or after key, or
+// at the last record if key is past the end.
+func (r *ConnectionHandler) browseSeek(key []any) error {
+	b := r.state.browser
+
+	b.head = nil
+	b.tail = nil
+
+	if err := b.cursor.Reset(); err != nil {
+		return fmt.Errorf("reset: %w", err)
+	}
+
+	if err := b.cursor.SetKey(key...); err != nil {
+		return fmt.Errorf("set key: %w", err)
+	}
+
+	cmp, err := b.cursor.SearchNear()
+	if errors.Is(err, wtgo.ErrNotFound) {
+		r.sendPage(wtshmsg.BrowseSeek, nil, true)
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("search near: %w", err)
+	}
+
+	if cmp == wtgo.CursorComparisonLessThan {
+		last, err := r.readRecord(b.cursor)
+		if err != nil {
+			return err
+		}
+
+		if !b.cursor.Next() {
+			if err := b.cursor.Reset(); err != nil {
+				return fmt.Errorf("reset: %w", err)
+			}
+
+			if err := b.cursor.SetKey(last.Key...); err != nil {
+				return fmt.Errorf("set key: %w", err)
+			}
+
+			if err := b.cursor.Search(); err != nil {
+				return fmt.Errorf("search: %w", err)
+			}
+		}
+	}
+
+	records := make([]record, 0, defaultBrowsePage)
+
+	ok := true
+	for ; ok; ok = b.cursor.Next() {
+		rec, err := r.readRecord(b.cursor)
+		if err != nil {
+			return err
+		}
+
+		records = append(records, rec)
+
+		if len(records) == defaultBrowsePage {
+			break
+		}
+	}
+
+	if err := b.cursor.Err(); err != nil {
+		return fmt.Errorf("iteration: %w", err)
+	}
+
+	b.head = records[0].Key
+	b.tail = records[len(records)-1].Key
+
+	r.sendPage(wtshmsg.BrowseSeek, records, !ok)
+
+	return nil
+}
+
+func (r *ConnectionHandler) sendPage(direction wtshmsg.BrowseDirection, records []record, end bool) {
+	m := wtshmsg.BrowsePageMessage{
+		Direction: direction,
+		Rows:      make([]wtshmsg.BrowseRow, 0, len(records)),
+		End:       end,
+	}
+
+	if len(records) > 0 {
+		m.Columns, m.Keys = columns(records, r.state.browser.schema)
+	}
+
+	b := r.state.browser
+
+	for _, rec := range records {
+		m.Rows = append(m.Rows, wtshmsg.BrowseRow{
+			Cells:  r.formatRow(rec, b.uri, m.Columns, "", true),
+			Detail: r.detailRow(rec, b.uri, m.Columns),
+		})
+	}
+
+	r.handler.HandleMessage(m)
+}
+
+// detailRow renders rec in full for the detail pane: decoded documents
+// pretty printed, and other raw bytes as a hex dump.
+func (r *ConnectionHandler) detailRow(rec record, uri string, cols []wtshmsg.Column) []string {
+	row := make([]string, 0, len(rec.Key)+len(rec.Value))
+
+	for i, d := range append(append([]any{}, rec.Key...), rec.Value...) {
+		if i < len(cols) {
+			if s, ok := r.decodeField(uri, cols[i].Name, d, false); ok {
+				row = append(row, s)
+				continue
+			}
+		}
+
+		if b, ok := d.([]byte); ok {
+			row = append(row, strings.TrimSuffix(hex.Dump(b), "\n"))
+			continue
+		}
+
+		row = append(row, formatValue(d))
+	}
+
+	return row
+}
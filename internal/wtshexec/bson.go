@@ -0,0 +1,116 @@
+package wtshexec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// BSON documents are shown as relaxed extended JSON, e.g. ObjectIds become
+// {"$oid": "..."} and datetimes {"$date": "..."}, except that int64 values
+// keep their canonical {"$numberLong": "..."} form so they don't come back
+// as int32. Any extended JSON is accepted when encoding.
+type bsonDecoder struct{}
+
+func newBSONDecoder(args []string) (decoder, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf("takes no arguments")
+	}
+
+	return bsonDecoder{}, nil
+}
+
+func (bsonDecoder) decode(b []byte) (any, error) {
+	if err := bson.Raw(b).Validate(); err != nil {
+		return nil, err
+	}
+
+	if n := len(b) - int(binary.LittleEndian.Uint32(b)); n != 0 {
+		return nil, fmt.Errorf("%d trailing bytes after document", n)
+	}
+
+	return bsonValue(bson.RawValue{Type: bson.TypeEmbeddedDocument, Value: b})
+}
+
+// bsonValue converts v to a value that marshals as its extended JSON.
+func bsonValue(v bson.RawValue) (any, error) {
+	switch v.Type {
+	case bson.TypeEmbeddedDocument:
+		elements, err := v.Document().Elements()
+		if err != nil {
+			return nil, err
+		}
+
+		doc := make(document, 0, len(elements))
+
+		for _, e := range elements {
+			value, err := bsonValue(e.Value())
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", e.Key(), err)
+			}
+
+			doc = append(doc, field{Name: e.Key(), Value: value})
+		}
+
+		return doc, nil
+	case bson.TypeArray:
+		values, err := v.Array().Values()
+		if err != nil {
+			return nil, err
+		}
+
+		a := make([]any, len(values))
+
+		for i, e := range values {
+			if a[i], err = bsonValue(e); err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+		}
+
+		return a, nil
+	case bson.TypeCodeWithScope:
+		code, scope := v.CodeWithScope()
+
+		s, err := bsonValue(bson.RawValue{Type: bson.TypeEmbeddedDocument, Value: scope})
+		if err != nil {
+			return nil, fmt.Errorf("$scope: %w", err)
+		}
+
+		return document{{Name: "$code", Value: code}, {Name: "$scope", Value: s}}, nil
+	case bson.TypeInt64:
+		return document{{Name: "$numberLong", Value: strconv.FormatInt(v.Int64(), 10)}}, nil
+	}
+
+	// everything else has no nested int64s, so the library's relaxed form
+	// can be used as is
+	data, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: v}}, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, err := parseJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	value, _ := wrapped.(document).get("v")
+
+	return value, nil
+}
+
+func (bsonDecoder) encode(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return nil, fmt.Errorf("a BSON value must be a JSON object")
+	}
+
+	var doc bson.Raw
+
+	if err := bson.UnmarshalExtJSON(data, false, &doc); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
@@ -0,0 +1,240 @@
+package wtshexec
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestBSONDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		want string
+	}{
+		{
+			// the example from bsonspec.org
+			name: "hello world",
+			in:   []byte("\x16\x00\x00\x00\x02hello\x00\x06\x00\x00\x00world\x00\x00"),
+			want: `{"hello":"world"}`,
+		},
+		{
+			name: "int32 and int64",
+			in:   []byte("\x17\x00\x00\x00\x10a\x00\xff\xff\xff\xff\x12b\x00\x00\x00\x00\x00\x01\x00\x00\x00\x00"),
+			want: `{"a":-1,"b":{"$numberLong":"4294967296"}}`,
+		},
+		{
+			name: "double",
+			in:   []byte("\x10\x00\x00\x00\x01f\x00\x00\x00\x00\x00\x00\x00\xf8\x3f\x00"),
+			want: `{"f":1.5}`,
+		},
+		{
+			name: "whole double",
+			in:   []byte("\x10\x00\x00\x00\x01f\x00\x00\x00\x00\x00\x00\x00\xf0\x3f\x00"),
+			want: `{"f":1.0}`,
+		},
+		{
+			name: "nan",
+			in:   []byte("\x10\x00\x00\x00\x01f\x00\x00\x00\x00\x00\x00\x00\xf8\x7f\x00"),
+			want: `{"f":{"$numberDouble":"NaN"}}`,
+		},
+		{
+			name: "array",
+			in:   []byte("\x1c\x00\x00\x00\x04a\x00\x14\x00\x00\x00\x080\x00\x01\x0a1\x00\x022\x00\x01\x00\x00\x00\x00\x00\x00"),
+			want: `{"a":[true,null,""]}`,
+		},
+		{
+			name: "object id",
+			in:   []byte("\x16\x00\x00\x00\x07_id\x00\x01\x23\x45\x67\x89\xab\xcd\xef\x01\x23\x45\x67\x00"),
+			want: `{"_id":{"$oid":"0123456789abcdef01234567"}}`,
+		},
+		{
+			name: "datetime",
+			in:   []byte("\x10\x00\x00\x00\x09d\x00\x00\x5c\x26\x05\x00\x00\x00\x00\x00"),
+			want: `{"d":{"$date":"1970-01-02T00:00:00Z"}}`,
+		},
+		{
+			name: "binary",
+			in:   []byte("\x0f\x00\x00\x00\x05b\x00\x02\x00\x00\x00\x04\x01\x02\x00"),
+			want: `{"b":{"$binary":{"base64":"AQI=","subType":"04"}}}`,
+		},
+		{
+			name: "timestamp",
+			in:   []byte("\x10\x00\x00\x00\x11t\x00\x02\x00\x00\x00\x01\x00\x00\x00\x00"),
+			want: `{"t":{"$timestamp":{"t":1,"i":2}}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := bsonDecoder{}.decode(tt.in)
+			if err != nil {
+				t.Fatalf("decode: %s", err)
+			}
+
+			got, err := json.Marshal(v)
+			if err != nil {
+				t.Fatalf("marshal: %s", err)
+			}
+
+			if string(got) != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBSONDecodeMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+	}{
+		{name: "empty", in: nil},
+		{name: "short", in: []byte("\x05\x00\x00")},
+		{name: "length past end", in: []byte("\x10\x00\x00\x00\x00")},
+		{name: "negative length", in: []byte("\xff\xff\xff\xff\x00")},
+		{name: "missing terminator", in: []byte("\x05\x00\x00\x00\x01")},
+		{name: "trailing bytes", in: []byte("\x05\x00\x00\x00\x00\x00")},
+		{name: "unterminated name", in: []byte("\x08\x00\x00\x00\x0aab\x00")},
+		{name: "truncated double", in: []byte("\x0c\x00\x00\x00\x01f\x00\x00\x00\x00\x00\x00")},
+		{name: "truncated int32", in: []byte("\x0a\x00\x00\x00\x10i\x00\x01\x00\x00")},
+		{name: "string length past end", in: []byte("\x0e\x00\x00\x00\x02s\x00\x09\x00\x00\x00a\x00\x00")},
+		{name: "string length zero", in: []byte("\x0c\x00\x00\x00\x02s\x00\x00\x00\x00\x00\x00")},
+		{name: "binary length past end", in: []byte("\x0f\x00\x00\x00\x05b\x00\x09\x00\x00\x00\x00\x01\x00")},
+		{name: "unsupported type", in: []byte("\x08\x00\x00\x00\x20x\x00\x00")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if v, err := (bsonDecoder{}).decode(tt.in); err == nil {
+				t.Errorf("decoded %v, want an error", v)
+			}
+		})
+	}
+}
+
+// TestBSONRoundTrip checks that every type decodes to extended JSON which
+// encodes back to the same bytes.
+func TestBSONRoundTrip(t *testing.T) {
+	id, _ := bson.ObjectIDFromHex("0123456789abcdef01234567")
+	dec, _ := bson.ParseDecimal128("-1.5E+3")
+
+	tests := []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{name: "double", value: 1.5, want: `1.5`},
+		{name: "whole double", value: 2.0, want: `2.0`},
+		{name: "infinite double", value: math.Inf(-1), want: `{"$numberDouble":"-Infinity"}`},
+		{name: "string", value: "x", want: `"x"`},
+		{name: "document", value: bson.D{{Key: "a", Value: int64(1)}}, want: `{"a":{"$numberLong":"1"}}`},
+		{name: "array", value: bson.A{int32(1), int64(2)}, want: `[1,{"$numberLong":"2"}]`},
+		{name: "binary", value: bson.Binary{Subtype: 0x80, Data: []byte{1, 2}}, want: `{"$binary":{"base64":"AQI=","subType":"80"}}`},
+		{name: "undefined", value: bson.Undefined{}, want: `{"$undefined":true}`},
+		{name: "object id", value: id, want: `{"$oid":"0123456789abcdef01234567"}`},
+		{name: "bool", value: true, want: `true`},
+		{name: "datetime", value: bson.DateTime(86400000), want: `{"$date":"1970-01-02T00:00:00Z"}`},
+		{name: "negative datetime", value: bson.DateTime(-1), want: `{"$date":{"$numberLong":"-1"}}`},
+		{name: "null", value: bson.Null{}, want: `null`},
+		{name: "regex", value: bson.Regex{Pattern: "^a", Options: "i"}, want: `{"$regularExpression":{"pattern":"^a","options":"i"}}`},
+		{name: "db pointer", value: bson.DBPointer{DB: "db.c", Pointer: id}, want: `{"$dbPointer":{"$ref":"db.c","$id":{"$oid":"0123456789abcdef01234567"}}}`},
+		{name: "code", value: bson.JavaScript("f()"), want: `{"$code":"f()"}`},
+		{name: "symbol", value: bson.Symbol("s"), want: `{"$symbol":"s"}`},
+		{name: "code with scope", value: bson.CodeWithScope{Code: "f()", Scope: bson.D{{Key: "n", Value: int64(7)}}}, want: `{"$code":"f()","$scope":{"n":{"$numberLong":"7"}}}`},
+		{name: "int32", value: int32(-5), want: `-5`},
+		{name: "timestamp", value: bson.Timestamp{T: 1, I: 2}, want: `{"$timestamp":{"t":1,"i":2}}`},
+		{name: "int64", value: int64(5), want: `{"$numberLong":"5"}`},
+		{name: "decimal", value: dec, want: `{"$numberDecimal":"-1.5E+3"}`},
+		{name: "min key", value: bson.MinKey{}, want: `{"$minKey":1}`},
+		{name: "max key", value: bson.MaxKey{}, want: `{"$maxKey":1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in, err := bson.Marshal(bson.D{{Key: "v", Value: tt.value}})
+			if err != nil {
+				t.Fatalf("marshal bson: %s", err)
+			}
+
+			v, err := bsonDecoder{}.decode(in)
+			if err != nil {
+				t.Fatalf("decode: %s", err)
+			}
+
+			got, err := json.Marshal(v)
+			if err != nil {
+				t.Fatalf("marshal: %s", err)
+			}
+
+			if want := `{"v":` + tt.want + `}`; string(got) != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+
+			out, err := bsonDecoder{}.encode(got)
+			if err != nil {
+				t.Fatalf("encode: %s", err)
+			}
+
+			if !bytes.Equal(out, in) {
+				t.Errorf("encoded % x, want % x", out, in)
+			}
+		})
+	}
+}
+
+func TestBSONEncode(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: `{"n":1,"big":5000000000,"f":1.5}`, want: `{"n":1,"big":{"$numberLong":"5000000000"},"f":1.5}`},
+		{in: `{"l":{"$numberLong":"5"},"i":{"$numberInt":"-5"},"d":{"$numberDouble":"1"}}`, want: `{"l":{"$numberLong":"5"},"i":-5,"d":1.0}`},
+		{in: `{"d":{"$date":{"$numberLong":"0"}}}`, want: `{"d":{"$date":"1970-01-01T00:00:00Z"}}`},
+		{in: `{"a":[1,"x",[false]],"d":{"e":{"f":"g"}}}`, want: `{"a":[1,"x",[false]],"d":{"e":{"f":"g"}}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			b, err := bsonDecoder{}.encode([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("encode: %s", err)
+			}
+
+			v, err := bsonDecoder{}.decode(b)
+			if err != nil {
+				t.Fatalf("decode: %s", err)
+			}
+
+			got, err := json.Marshal(v)
+			if err != nil {
+				t.Fatalf("marshal: %s", err)
+			}
+
+			if string(got) != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBSONEncodeInvalid(t *testing.T) {
+	for _, in := range []string{
+		`[1]`,
+		`{"a":1`,
+		`{"_id":{"$oid":"0123"}}`,
+		`{"d":{"$date":"yesterday"}}`,
+		`{"l":{"$numberLong":5}}`,
+		`{"b":{"$binary":{"base64":"!","subType":"00"}}}`,
+		`{"b":{"$binary":{"base64":"","subType":"zz"}}}`,
+		`{"t":{"$timestamp":{"t":1}}}`,
+		`{"x":{"$numberDecimal":"one"}}`,
+	} {
+		if b, err := (bsonDecoder{}).encode([]byte(in)); err == nil {
+			t.Errorf("%s: encoded %x, want an error", in, b)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package wtshexec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"wtsh/internal/wtshmsg"
+)
+
+// A decoder turns stored bytes into a value that marshals to JSON, and JSON
+// back into stored bytes so documents can be written as JSON too.
+type decoder interface {
+	decode(b []byte) (any, error)
+	encode(data []byte) ([]byte, error)
+}
+
+var decoderFactories = map[string]func(args []string) (decoder, error){
+	"json":    newJSONDecoder,
+	"bson":    newBSONDecoder,
+	"msgpack": newMsgpackDecoder,
+	"proto":   newProtoDecoder,
+}
+
+type columnDecoder struct {
+	spec    string
+	decoder decoder
+}
+
+// decodeCommand implements \decode [<uri> <column> <decoder> [args] | none].
+func (r *ConnectionHandler) decodeCommand(args string) error {
+	fields := strings.Fields(args)
+
+	if len(fields) == 0 {
+		r.handler.HandleMessage(r.decoderList())
+		return nil
+	}
+
+	if len(fields) < 3 {
+		return fmt.Errorf(`parse: \decode <uri> <column> <decoder> [args] | none`)
+	}
+
+	uri, column, name := tableURI(fields[0]), fields[1], fields[2]
+
+	if name == "none" {
+		delete(r.decoders[uri], column)
+		return nil
+	}
+
+	factory, ok := decoderFactories[name]
+	if !ok {
+		return fmt.Errorf("'%s' is not a decoder, expected json, bson, msgpack or proto", name)
+	}
+
+	d, err := factory(fields[3:])
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	if r.decoders == nil {
+		r.decoders = make(map[string]map[string]columnDecoder)
+	}
+
+	if r.decoders[uri] == nil {
+		r.decoders[uri] = make(map[string]columnDecoder)
+	}
+
+	r.decoders[uri][column] = columnDecoder{spec: strings.Join(fields[2:], " "), decoder: d}
+
+	return nil
+}
+
+func (r *ConnectionHandler) decoderList() wtshmsg.ResultMessage {
+	rows := make([][]string, 0)
+
+	for uri, columns := range r.decoders {
+		for column, d := range columns {
+			rows = append(rows, []string{uri, column, d.spec})
+		}
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i][0] != rows[j][0] {
+			return rows[i][0] < rows[j][0]
+		}
+
+		return rows[i][1] < rows[j][1]
+	})
+
+	columns := []wtshmsg.Column{{Name: "uri", Type: "S"}, {Name: "column", Type: "S"}, {Name: "decoder", Type: "S"}}
+
+	return wtshmsg.ResultMessage{Columns: columns, Rows: rows, Keys: 2}
+}
+
+// decodeField renders a field through its column's decoder, pretty printed
+// unless inline is set. ok is false if there is no decoder or it failed.
+func (r *ConnectionHandler) decodeField(uri, column string, v any, inline bool) (string, bool) {
+	d, found := r.decoders[tableURI(uri)][column]
+	if !found {
+		return "", false
+	}
+
+	var b []byte
+
+	switch v := v.(type) {
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return "", false
+	}
+
+	doc, err := d.decoder.decode(b)
+	if err != nil {
+		r.logger.Printf("decode %s %s: %s\n", uri, column, err)
+		return "", false
+	}
+
+	var out []byte
+
+	if inline {
+		out, err = json.Marshal(doc)
+	} else {
+		out, err = json.MarshalIndent(doc, "", "  ")
+	}
+
+	if err != nil {
+		r.logger.Printf("decode %s %s: %s\n", uri, column, err)
+		return "", false
+	}
+
+	return string(out), true
+}
+
+// encodeValues converts value arguments for a table with decoders, where
+// each argument for a decoded column is a JSON document. Arguments are split
+// on commas outside of JSON objects, arrays and strings.
+func (r *ConnectionHandler) encodeValues(uri string, s string, sch schema) ([]any, bool, error) {
+	columns := r.decoders[tableURI(uri)]
+	if len(columns) == 0 {
+		return nil, false, nil
+	}
+
+	fields := splitJSONFields(s)
+	names := sch.header(record{Key: make([]any, len(sch.keyFormat)), Value: make([]any, len(fields))})[len(sch.keyFormat):]
+
+	args := make([]any, len(fields))
+
+	for i, f := range fields {
+		args[i] = f
+
+		d, ok := columns[names[i].Name]
+		if !ok {
+			continue
+		}
+
+		b, err := d.decoder.encode([]byte(f))
+		if err != nil {
+			return nil, true, fmt.Errorf("%s: %w", names[i].Name, err)
+		}
+
+		args[i] = b
+	}
+
+	values, err := convertFields(args, sch.valueFormat)
+
+	return values, true, err
+}
+
+func splitJSONFields(s string) []string {
+	fields := make([]string, 0, 2)
+
+	depth := 0
+	quoted := false
+	start := 0
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '{' || c == '[':
+			depth++
+		case c == '}' || c == ']':
+			depth--
+		case c == ',' && depth == 0:
+			fields = append(fields, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(fields, s[start:])
+}
+
+type field struct {
+	Name  string
+	Value any
+}
+
+// document is a JSON object that keeps the order of its fields.
+type document []field
+
+func (d document) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+
+	buf.WriteByte('{')
+
+	for i, f := range d {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		name, err := json.Marshal(f.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := json.Marshal(f.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+func (d document) get(name string) (any, bool) {
+	for _, f := range d {
+		if f.Name == name {
+			return f.Value, true
+		}
+	}
+
+	return nil, false
+}
+
+// parseJSON parses a JSON value, keeping object fields in order and numbers
+// as json.Number.
+func parseJSON(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	v, err := parseJSONValue(dec)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+
+	return v, nil
+}
+
+func parseJSONValue(dec *json.Decoder) (any, error) {
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t {
+	case json.Delim('{'):
+		doc := document{}
+
+		for dec.More() {
+			k, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+
+			v, err := parseJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+
+			doc = append(doc, field{Name: k.(string), Value: v})
+		}
+
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+
+		return doc, nil
+	case json.Delim('['):
+		a := []any{}
+
+		for dec.More() {
+			v, err := parseJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+
+			a = append(a, v)
+		}
+
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+
+		return a, nil
+	}
+
+	return t, nil
+}
+
+type jsonDecoder struct{}
+
+func newJSONDecoder(args []string) (decoder, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf("takes no arguments")
+	}
+
+	return jsonDecoder{}, nil
+}
+
+func (jsonDecoder) decode(b []byte) (any, error) {
+	if !json.Valid(b) {
+		return nil, fmt.Errorf("not valid JSON")
+	}
+
+	return json.RawMessage(b), nil
+}
+
+func (jsonDecoder) encode(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if err := json.Compact(&buf, data); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,298 @@
+package wtshexec
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"wtsh/internal/wtshmsg"
+
+	"github.com/dylrich/wtgo"
+)
+
+const diffUsage = "parse: diff <uriA> <uriB> [--home-b path] [--limit n]"
+
+// diff implements the diff command, walking both tables in key order and
+// reporting keys only in A (<), only in B (>) and keys whose values differ
+// (≠). With --home-b, uriB is read from a second database opened read-only.
+// The walk stops after limit differences.
+func (r *ConnectionHandler) diff(args string) error {
+	fields := strings.Fields(args)
+
+	var uris []string
+	var homeB string
+
+	limit := -1
+
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "--home-b", "--limit":
+			if i+1 >= len(fields) {
+				return fmt.Errorf("parse: %s requires a value", fields[i])
+			}
+
+			if fields[i] == "--home-b" {
+				homeB = fields[i+1]
+			} else {
+				n, err := strconv.Atoi(fields[i+1])
+				if err != nil {
+					return fmt.Errorf("parse: limit: %w", err)
+				}
+
+				limit = n
+			}
+
+			i++
+		default:
+			if strings.HasPrefix(fields[i], "--") {
+				return fmt.Errorf("parse: unknown option '%s'", fields[i])
+			}
+
+			uris = append(uris, fields[i])
+		}
+	}
+
+	if len(uris) != 2 {
+		return fmt.Errorf(diffUsage)
+	}
+
+	uriA, uriB := uris[0], uris[1]
+	sessionB := r.state.session
+
+	if homeB != "" {
+		conn, err := wtgo.Open(homeB, "readonly=true")
+		if err != nil {
+			return fmt.Errorf("open '%s': %w", homeB, err)
+		}
+		defer conn.Close("")
+
+		if sessionB, err = conn.OpenSession(""); err != nil {
+			return fmt.Errorf("open session on '%s': %w", homeB, err)
+		}
+	}
+
+	start := time.Now()
+
+	schA, err := r.schema(uriA)
+	if err != nil {
+		r.logger.Printf("no formats for '%s': %s\n", uriA, err)
+	}
+
+	schB, err := r.schemaIn(sessionB, uriB)
+	if err != nil {
+		r.logger.Printf("no formats for '%s': %s\n", uriB, err)
+	}
+
+	a, err := r.state.session.OpenCursor(uriA, "")
+	if err != nil {
+		return fmt.Errorf("open cursor on '%s': %w", uriA, err)
+	}
+	defer a.Close()
+
+	b, err := sessionB.OpenCursor(uriB, "")
+	if err != nil {
+		return fmt.Errorf("open cursor on '%s': %w", uriB, err)
+	}
+	defer b.Close()
+
+	d := diffResult{DiffMessage: wtshmsg.DiffMessage{A: uriA, B: uriB, HomeB: homeB}}
+
+	recA, okA, err := r.nextRecord(a)
+	if err != nil {
+		return err
+	}
+
+	recB, okB, err := r.nextRecord(b)
+	if err != nil {
+		return err
+	}
+
+	for (okA || okB) && limit != 0 {
+		c := -1
+
+		switch {
+		case !okA:
+			c = 1
+		case okB:
+			if c, err = compareFields(recA.Key, recB.Key); err != nil {
+				return fmt.Errorf("compare: %w", err)
+			}
+		}
+
+		switch {
+		case c < 0:
+			d.add("<", &recA, nil)
+		case c > 0:
+			d.add(">", nil, &recB)
+		case equalFields(recA.Value, recB.Value):
+			d.Same++
+		default:
+			d.add("≠", &recA, &recB)
+		}
+
+		if c <= 0 {
+			if recA, okA, err = r.nextRecord(a); err != nil {
+				return err
+			}
+		}
+
+		if c >= 0 {
+			if recB, okB, err = r.nextRecord(b); err != nil {
+				return err
+			}
+		}
+
+		if len(d.rows) == limit {
+			d.Stopped = okA || okB
+			break
+		}
+	}
+
+	if err := a.Err(); err != nil {
+		return fmt.Errorf("iteration of '%s': %w", uriA, err)
+	}
+
+	if err := b.Err(); err != nil {
+		return fmt.Errorf("iteration of '%s': %w", uriB, err)
+	}
+
+	r.handler.HandleMessage(r.diffRows(d, schA, schB, time.Since(start)))
+	r.handler.HandleMessage(d.DiffMessage)
+
+	return nil
+}
+
+// nextRecord moves cursor on and reads the record there, if there is one.
+func (r *ConnectionHandler) nextRecord(cursor *wtgo.Cursor) (record, bool, error) {
+	if !cursor.Next() {
+		return record{}, false, nil
+	}
+
+	rec, err := r.readRecord(cursor)
+
+	return rec, err == nil, err
+}
+
+type diffRow struct {
+	mark string
+	a, b *record
+}
+
+type diffResult struct {
+	wtshmsg.DiffMessage
+	rows []diffRow
+}
+
+func (d *diffResult) add(mark string, a, b *record) {
+	switch mark {
+	case "<":
+		d.OnlyA++
+	case ">":
+		d.OnlyB++
+	default:
+		d.Differ++
+	}
+
+	row := diffRow{mark: mark}
+
+	if a != nil {
+		rec := *a
+		row.a = &rec
+	}
+
+	if b != nil {
+		rec := *b
+		row.b = &rec
+	}
+
+	d.rows = append(d.rows, row)
+}
+
+// diffRows lays the records out side by side: the mark, the key, then the
+// values from A and B with their columns prefixed a. and b.
+func (r *ConnectionHandler) diffRows(d diffResult, schA, schB schema, elapsed time.Duration) wtshmsg.ResultMessage {
+	recordsA := make([]record, 0, 1)
+	recordsB := make([]record, 0, 1)
+
+	for _, row := range d.rows {
+		if row.a != nil {
+			recordsA = append(recordsA, *row.a)
+		}
+
+		if row.b != nil {
+			recordsB = append(recordsB, *row.b)
+		}
+	}
+
+	colsA, keysA := columns(recordsA, schA)
+	colsB, keysB := columns(recordsB, schB)
+
+	keyColumns := colsA[:keysA]
+	if len(recordsA) == 0 && len(recordsB) > 0 {
+		keyColumns = colsB[:keysB]
+	}
+
+	m := wtshmsg.ResultMessage{Keys: 1 + len(keyColumns), Elapsed: elapsed}
+
+	m.Columns = append(m.Columns, wtshmsg.Column{Name: "diff", Type: "S"})
+	m.Columns = append(m.Columns, keyColumns...)
+
+	for _, c := range colsA[keysA:] {
+		m.Columns = append(m.Columns, wtshmsg.Column{Name: "a." + c.Name, Type: c.Type})
+	}
+
+	for _, c := range colsB[keysB:] {
+		m.Columns = append(m.Columns, wtshmsg.Column{Name: "b." + c.Name, Type: c.Type})
+	}
+
+	for _, row := range d.rows {
+		var fromA, fromB []string
+
+		if row.a != nil {
+			fromA = r.formatRow(*row.a, d.A, colsA, "", true)
+		}
+
+		if row.b != nil {
+			fromB = r.formatRow(*row.b, d.B, colsB, "", true)
+		}
+
+		key := fromA
+		if key == nil {
+			key = fromB
+		}
+
+		cells := append([]string{row.mark}, padCells(key, 0, len(keyColumns))...)
+		cells = append(cells, padCells(fromA, keysA, len(colsA)-keysA)...)
+		cells = append(cells, padCells(fromB, keysB, len(colsB)-keysB)...)
+
+		m.Rows = append(m.Rows, cells)
+	}
+
+	return m
+}
+
+// padCells returns width cells of a formatted row from skip on, left empty
+// where the row is missing or short.
+func padCells(row []string, skip, width int) []string {
+	cells := make([]string, width)
+
+	if row != nil {
+		copy(cells, row[min(skip, len(row)):])
+	}
+
+	return cells
+}
+
+func equalFields(a, b []any) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !equalValues(a[i], b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
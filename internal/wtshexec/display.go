@@ -0,0 +1,218 @@
+package wtshexec
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+	"wtsh/internal/wtshmsg"
+)
+
+var displayModes = map[string]bool{
+	"auto":    true,
+	"utf8":    true,
+	"hex":     true,
+	"base64":  true,
+	"hexdump": true,
+}
+
+// values up to this many bytes are shown as one line of hex in auto mode,
+// anything longer gets a hex dump
+const autoHexLimit = 32
+
+// display holds the modes set with \display: one for every column, and
+// overrides for columns by name.
+type display struct {
+	all     string
+	columns map[string]string
+}
+
+func (d display) mode(column string) string {
+	if m, ok := d.columns[column]; ok {
+		return m
+	}
+
+	if d.all != "" {
+		return d.all
+	}
+
+	return "auto"
+}
+
+func validDisplayMode(mode string) error {
+	if !displayModes[mode] {
+		return fmt.Errorf("'%s' is not a display mode, expected auto, utf8, hex, base64 or hexdump", mode)
+	}
+
+	return nil
+}
+
+// displayCommand implements \display [mode | <column> <mode> | reset].
+func (r *ConnectionHandler) displayCommand(args string) error {
+	fields := strings.Fields(args)
+
+	switch len(fields) {
+	case 0:
+		r.handler.HandleMessage(r.displayModes())
+	case 1:
+		if fields[0] == "reset" {
+			r.display = display{}
+			break
+		}
+
+		if err := validDisplayMode(fields[0]); err != nil {
+			return err
+		}
+
+		r.display.all = fields[0]
+	case 2:
+		if err := validDisplayMode(fields[1]); err != nil {
+			return err
+		}
+
+		if r.display.columns == nil {
+			r.display.columns = make(map[string]string)
+		}
+
+		r.display.columns[fields[0]] = fields[1]
+	default:
+		return fmt.Errorf(`parse: \display [mode | <column> <mode> | reset]`)
+	}
+
+	return nil
+}
+
+func (r *ConnectionHandler) displayModes() wtshmsg.ResultMessage {
+	rows := [][]string{{"*", r.display.mode("*")}}
+
+	names := make([]string, 0, len(r.display.columns))
+	for name := range r.display.columns {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		rows = append(rows, []string{name, r.display.columns[name]})
+	}
+
+	columns := []wtshmsg.Column{{Name: "column", Type: "S"}, {Name: "mode", Type: "S"}}
+
+	return wtshmsg.ResultMessage{Columns: columns, Rows: rows, Keys: 1}
+}
+
+// displayFlag removes "--display <mode>" from a command's arguments.
+func displayFlag(args string) (string, string, error) {
+	fields := strings.Fields(args)
+
+	for i, f := range fields {
+		if f != "--display" {
+			continue
+		}
+
+		if i+1 >= len(fields) {
+			return "", "", fmt.Errorf("parse: --display requires a value")
+		}
+
+		mode := fields[i+1]
+		if err := validDisplayMode(mode); err != nil {
+			return "", "", err
+		}
+
+		rest := append(fields[:i:i], fields[i+2:]...)
+
+		return strings.Join(rest, " "), mode, nil
+	}
+
+	return args, "", nil
+}
+
+// formatRow renders each field of rec for display, through the decoder set
+// for its column in uri if any. mode overrides decoders and the configured
+// modes when set, and inline keeps every cell to a single line.
+func (r *ConnectionHandler) formatRow(rec record, uri string, cols []wtshmsg.Column, mode string, inline bool) []string {
+	fields := append(append(make([]any, 0, len(rec.Key)+len(rec.Value)), rec.Key...), rec.Value...)
+	row := make([]string, 0, len(fields))
+
+	for i, d := range fields {
+		name := ""
+		if i < len(cols) {
+			name = cols[i].Name
+		}
+
+		if mode == "" {
+			if s, ok := r.decodeField(uri, name, d, inline); ok {
+				row = append(row, s)
+				continue
+			}
+		}
+
+		m := mode
+		if m == "" {
+			m = r.display.mode(name)
+		}
+
+		row = append(row, formatDisplay(d, m, inline))
+	}
+
+	return row
+}
+
+func formatDisplay(v any, mode string, inline bool) string {
+	var b []byte
+
+	switch v := v.(type) {
+	case []byte:
+		b = v
+	case string:
+		if mode == "auto" || mode == "utf8" {
+			return v
+		}
+
+		b = []byte(v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+
+	if mode == "hexdump" && inline {
+		mode = "hex"
+	}
+
+	switch mode {
+	case "utf8":
+		return strings.ToValidUTF8(string(b), string(utf8.RuneError))
+	case "hex":
+		return hex.EncodeToString(b)
+	case "base64":
+		return base64.StdEncoding.EncodeToString(b)
+	case "hexdump":
+		return strings.TrimSuffix(hex.Dump(b), "\n")
+	}
+
+	if printable(b) {
+		return string(b)
+	}
+
+	if len(b) <= autoHexLimit || inline {
+		return hex.EncodeToString(b)
+	}
+
+	return strings.TrimSuffix(hex.Dump(b), "\n")
+}
+
+func printable(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) && r != '\t' {
+			return false
+		}
+	}
+
+	return true
+}
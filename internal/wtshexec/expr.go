@@ -0,0 +1,738 @@
+package wtshexec
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenVariable
+	tokenIdent
+	tokenOperator
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func tokenize(s string) ([]token, error) {
+	tokens := make([]token, 0, 8)
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '$':
+			var ref string
+
+			if i+1 < len(s) && s[i+1] == '{' {
+				end := strings.IndexByte(s[i:], '}')
+				if end == -1 {
+					return nil, fmt.Errorf("unterminated '${'")
+				}
+
+				ref = s[i+2 : i+end]
+				i += end + 1
+			} else {
+				j := scanReference(s, i+1)
+				ref = s[i+1 : j]
+				i = j
+			}
+
+			if ref == "" {
+				return nil, fmt.Errorf("expected variable name after '$'")
+			}
+
+			tokens = append(tokens, token{kind: tokenVariable, text: ref})
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(s) && s[j] != c {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+
+			if j >= len(s) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+
+			text := s[i+1 : j]
+			if c == '"' {
+				unquoted, err := strconv.Unquote(s[i : j+1])
+				if err != nil {
+					return nil, fmt.Errorf("string: %w", err)
+				}
+
+				text = unquoted
+			}
+
+			tokens = append(tokens, token{kind: tokenString, text: text})
+			i = j + 1
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.' || s[j] == 'x' || s[j] >= 'a' && s[j] <= 'f' || s[j] >= 'A' && s[j] <= 'F') {
+				j++
+			}
+
+			tokens = append(tokens, token{kind: tokenNumber, text: s[i:j]})
+			i = j
+		case isNameByte(c):
+			j := i
+			for j < len(s) && isNameByte(s[j]) {
+				j++
+			}
+
+			tokens = append(tokens, token{kind: tokenIdent, text: s[i:j]})
+			i = j
+		default:
+			op := ""
+			for _, o := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")", ","} {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+
+			if op == "" {
+				return nil, fmt.Errorf("unexpected '%c'", c)
+			}
+
+			tokens = append(tokens, token{kind: tokenOperator, text: op})
+			i += len(op)
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF}), nil
+}
+
+type exprParser struct {
+	tokens []token
+	pos    int
+	lookup func(ref string) (any, error)
+}
+
+// eval evaluates an expression over typed variable values. && and || short
+// circuit, so the right hand side is only resolved when it is needed.
+func (r *ConnectionHandler) eval(expr string) (any, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{
+		tokens: tokens,
+		lookup: r.lookup,
+	}
+
+	v, err := p.or(true)
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected '%s'", t.text)
+	}
+
+	return v, nil
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+
+	return t
+}
+
+func (p *exprParser) accept(op string) bool {
+	t := p.peek()
+	if t.kind == tokenOperator && t.text == op {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+func (p *exprParser) or(live bool) (any, error) {
+	v, err := p.and(live)
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("||") {
+		left := truthy(v)
+
+		w, err := p.and(live && !left)
+		if err != nil {
+			return nil, err
+		}
+
+		v = left || truthy(w)
+	}
+
+	return v, nil
+}
+
+func (p *exprParser) and(live bool) (any, error) {
+	v, err := p.not(live)
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("&&") {
+		left := truthy(v)
+
+		w, err := p.not(live && left)
+		if err != nil {
+			return nil, err
+		}
+
+		v = left && truthy(w)
+	}
+
+	return v, nil
+}
+
+func (p *exprParser) not(live bool) (any, error) {
+	if p.accept("!") {
+		v, err := p.not(live)
+		if err != nil {
+			return nil, err
+		}
+
+		return !truthy(v), nil
+	}
+
+	return p.comparison(live)
+}
+
+func (p *exprParser) comparison(live bool) (any, error) {
+	v, err := p.additive(live)
+	if err != nil {
+		return nil, err
+	}
+
+	t := p.peek()
+	if t.kind != tokenOperator {
+		return v, nil
+	}
+
+	switch t.text {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return v, nil
+	}
+
+	p.next()
+
+	w, err := p.additive(live)
+	if err != nil {
+		return nil, err
+	}
+
+	if !live {
+		return false, nil
+	}
+
+	if t.text == "==" || t.text == "!=" {
+		eq := equalValues(v, w)
+		return eq == (t.text == "=="), nil
+	}
+
+	c, err := compareValues(v, w)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t.text {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+func (p *exprParser) additive(live bool) (any, error) {
+	v, err := p.multiplicative(live)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		var op string
+
+		switch {
+		case p.accept("+"):
+			op = "+"
+		case p.accept("-"):
+			op = "-"
+		default:
+			return v, nil
+		}
+
+		w, err := p.multiplicative(live)
+		if err != nil {
+			return nil, err
+		}
+
+		if !live {
+			continue
+		}
+
+		v, err = arithmetic(op, v, w)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *exprParser) multiplicative(live bool) (any, error) {
+	v, err := p.unary(live)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		var op string
+
+		switch {
+		case p.accept("*"):
+			op = "*"
+		case p.accept("/"):
+			op = "/"
+		case p.accept("%"):
+			op = "%"
+		default:
+			return v, nil
+		}
+
+		w, err := p.unary(live)
+		if err != nil {
+			return nil, err
+		}
+
+		if !live {
+			continue
+		}
+
+		v, err = arithmetic(op, v, w)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *exprParser) unary(live bool) (any, error) {
+	if p.accept("-") {
+		v, err := p.unary(live)
+		if err != nil || !live {
+			return v, err
+		}
+
+		return arithmetic("-", int64(0), v)
+	}
+
+	return p.primary(live)
+}
+
+func (p *exprParser) primary(live bool) (any, error) {
+	t := p.next()
+
+	switch t.kind {
+	case tokenNumber:
+		return parseNumber(t.text)
+	case tokenString:
+		return t.text, nil
+	case tokenVariable:
+		if !live {
+			return nil, nil
+		}
+
+		return p.lookup(t.text)
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "nil":
+			return nil, nil
+		}
+
+		if !p.accept("(") {
+			return nil, fmt.Errorf("unknown identifier '%s'", t.text)
+		}
+
+		args := make([]any, 0, 2)
+
+		if !p.accept(")") {
+			for {
+				a, err := p.or(live)
+				if err != nil {
+					return nil, err
+				}
+
+				args = append(args, a)
+
+				if p.accept(")") {
+					break
+				}
+
+				if !p.accept(",") {
+					return nil, fmt.Errorf("expected ',' or ')' in call to %s", t.text)
+				}
+			}
+		}
+
+		if !live {
+			return nil, nil
+		}
+
+		return call(t.text, args)
+	case tokenOperator:
+		if t.text == "(" {
+			v, err := p.or(live)
+			if err != nil {
+				return nil, err
+			}
+
+			if !p.accept(")") {
+				return nil, fmt.Errorf("expected ')'")
+			}
+
+			return v, nil
+		}
+
+		return nil, fmt.Errorf("unexpected '%s'", t.text)
+	}
+
+	return nil, fmt.Errorf("unexpected end of expression")
+}
+
+func call(name string, args []any) (any, error) {
+	arity := map[string]int{
+		"len":      1,
+		"int":      1,
+		"str":      1,
+		"contains": 2,
+		"prefix":   2,
+	}
+
+	n, ok := arity[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function '%s'", name)
+	}
+
+	if len(args) != n {
+		return nil, fmt.Errorf("%s takes %d arguments, got %d", name, n, len(args))
+	}
+
+	switch name {
+	case "len":
+		switch v := args[0].(type) {
+		case string:
+			return int64(len(v)), nil
+		case []byte:
+			return int64(len(v)), nil
+		case []any:
+			return int64(len(v)), nil
+		case []record:
+			return int64(len(v)), nil
+		case nil:
+			return int64(0), nil
+		default:
+			return int64(1), nil
+		}
+	case "int":
+		v, ok := number(args[0])
+		if !ok {
+			return nil, fmt.Errorf("cannot convert %s to a number", describeValue(args[0]))
+		}
+
+		if f, ok := v.(float64); ok {
+			return int64(f), nil
+		}
+
+		return v, nil
+	case "str":
+		return formatValue(args[0]), nil
+	case "contains":
+		return strings.Contains(formatValue(args[0]), formatValue(args[1])), nil
+	default:
+		return strings.HasPrefix(formatValue(args[0]), formatValue(args[1])), nil
+	}
+}
+
+func parseNumber(s string) (any, error) {
+	if strings.ContainsAny(s, ".eE") && !strings.HasPrefix(s, "0x") {
+		return strconv.ParseFloat(s, 64)
+	}
+
+	if n, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return n, nil
+	}
+
+	return strconv.ParseUint(s, 0, 64)
+}
+
+func truthy(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case []byte:
+		return len(v) != 0
+	case []any:
+		return len(v) != 0
+	case []record:
+		return len(v) != 0
+	}
+
+	if n, ok := number(v); ok {
+		switch n := n.(type) {
+		case int64:
+			return n != 0
+		case uint64:
+			return n != 0
+		case float64:
+			return n != 0
+		}
+	}
+
+	return true
+}
+
+// number normalises WiredTiger's integer types to int64, or uint64 where the
+// value does not fit. Strings are parsed so that `set` values compare
+// numerically against typed cursor values.
+func number(v any) (any, bool) {
+	switch v := v.(type) {
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int64(v), true
+		}
+
+		return v, true
+	case float64:
+		return v, true
+	case string:
+		n, err := parseNumber(strings.TrimSpace(v))
+		if err != nil {
+			return nil, false
+		}
+
+		return number(n)
+	}
+
+	return nil, false
+}
+
+func isText(v any) bool {
+	switch v.(type) {
+	case string, []byte:
+		return true
+	}
+
+	return false
+}
+
+func toFloat(v any) float64 {
+	switch v := v.(type) {
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	default:
+		return v.(float64)
+	}
+}
+
+func compareNumbers(a, b any) int {
+	switch a := a.(type) {
+	case int64:
+		if b, ok := b.(int64); ok {
+			switch {
+			case a < b:
+				return -1
+			case a > b:
+				return 1
+			}
+
+			return 0
+		}
+	case uint64:
+		if b, ok := b.(uint64); ok {
+			switch {
+			case a < b:
+				return -1
+			case a > b:
+				return 1
+			}
+
+			return 0
+		}
+	}
+
+	fa, fb := toFloat(a), toFloat(b)
+
+	switch {
+	case fa < fb:
+		return -1
+	case fa > fb:
+		return 1
+	}
+
+	return 0
+}
+
+func compareValues(a, b any) (int, error) {
+	// two strings compare as text even if they look like numbers
+	if isText(a) && isText(b) {
+		return bytes.Compare([]byte(formatValue(a)), []byte(formatValue(b))), nil
+	}
+
+	na, aok := number(a)
+	nb, bok := number(b)
+
+	if aok && bok {
+		return compareNumbers(na, nb), nil
+	}
+
+	if ra, ok := a.([]any); ok {
+		if rb, ok := b.([]any); ok {
+			return compareFields(ra, rb)
+		}
+	}
+
+	return 0, fmt.Errorf("cannot compare %s with %s", describeValue(a), describeValue(b))
+}
+
+func compareFields(a, b []any) (int, error) {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		c, err := compareValues(a[i], b[i])
+		if err != nil {
+			return 0, err
+		}
+
+		if c != 0 {
+			return c, nil
+		}
+	}
+
+	return len(a) - len(b), nil
+}
+
+func equalValues(a, b any) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	if ba, ok := a.(bool); ok {
+		bb, ok := b.(bool)
+		return ok && ba == bb
+	}
+
+	if c, err := compareValues(a, b); err == nil {
+		return c == 0
+	}
+
+	return formatValue(a) == formatValue(b)
+}
+
+func arithmetic(op string, a, b any) (any, error) {
+	if op == "+" && (isText(a) || isText(b)) {
+		_, aok := number(a)
+		_, bok := number(b)
+
+		if !aok || !bok || isText(a) && isText(b) {
+			return formatValue(a) + formatValue(b), nil
+		}
+	}
+
+	na, aok := number(a)
+	nb, bok := number(b)
+
+	if !aok || !bok {
+		return nil, fmt.Errorf("cannot apply '%s' to %s and %s", op, describeValue(a), describeValue(b))
+	}
+
+	ia, aint := na.(int64)
+	ib, bint := nb.(int64)
+
+	if aint && bint {
+		switch op {
+		case "+":
+			return ia + ib, nil
+		case "-":
+			return ia - ib, nil
+		case "*":
+			return ia * ib, nil
+		}
+
+		if ib == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+
+		if op == "/" {
+			return ia / ib, nil
+		}
+
+		return ia % ib, nil
+	}
+
+	fa, fb := toFloat(na), toFloat(nb)
+
+	switch op {
+	case "+":
+		return fa + fb, nil
+	case "-":
+		return fa - fb, nil
+	case "*":
+		return fa * fb, nil
+	case "/":
+		return fa / fb, nil
+	}
+
+	return math.Mod(fa, fb), nil
+}
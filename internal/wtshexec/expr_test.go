@@ -0,0 +1,132 @@
+package wtshexec
+
+import (
+	"io"
+	"log"
+	"math"
+	"reflect"
+	"testing"
+)
+
+type discardHandler struct{}
+
+func (discardHandler) HandleMessage(any) {}
+
+func newTestHandler(vars map[string]any) *ConnectionHandler {
+	r := New(nil, log.New(io.Discard, "", 0), discardHandler{}, func() {})
+
+	for name, v := range vars {
+		r.vars[name] = v
+	}
+
+	return r
+}
+
+func TestEval(t *testing.T) {
+	r := newTestHandler(map[string]any{
+		"i32":  int32(5),
+		"u64":  uint64(5),
+		"max":  uint64(math.MaxUint64),
+		"neg":  int64(-1),
+		"s":    "abc",
+		"b":    []byte("abc"),
+		"num":  "10",
+		"rec":  record{Key: []any{int32(1)}, Value: []any{"x", uint8(2)}},
+		"zero": int64(0),
+	})
+
+	tests := []struct {
+		expr string
+		want any
+	}{
+		// precedence and associativity
+		{expr: "1 + 2 * 3", want: int64(7)},
+		{expr: "(1 + 2) * 3", want: int64(9)},
+		{expr: "10 - 4 - 3", want: int64(3)},
+		{expr: "7 / 2", want: int64(3)},
+		{expr: "7 % 4", want: int64(3)},
+		{expr: "7.0 / 2", want: 3.5},
+		{expr: "-2 * 3", want: int64(-6)},
+		{expr: "- -2", want: int64(2)},
+		{expr: "1 + 2 == 3", want: true},
+		{expr: "!false && false", want: false},
+		{expr: "true || false && false", want: true},
+		{expr: "(true || false) && false", want: false},
+		{expr: "2 > 1 && 3 >= 3", want: true},
+		{expr: "!(1 < 2)", want: false},
+
+		// short circuits skip undefined variables
+		{expr: "false && $undefined", want: false},
+		{expr: "true || $undefined == 1", want: true},
+
+		// typed comparisons
+		{expr: "$i32 == $u64", want: true},
+		{expr: "$i32 + $u64", want: int64(10)},
+		{expr: "$max > $neg", want: true},
+		{expr: "$max == 18446744073709551615", want: true},
+		{expr: "$max > 18446744073709551614", want: true},
+		{expr: "$neg < $zero", want: true},
+		{expr: "$s == $b", want: true},
+		{expr: `$b < "abd"`, want: true},
+		{expr: `$s == "abc"`, want: true},
+		{expr: `"10" < "9"`, want: true},
+		{expr: `$num > 9`, want: true},
+		{expr: `$num == 10`, want: true},
+		{expr: "nil == nil", want: true},
+		{expr: "$zero == nil", want: false},
+		{expr: "true == 1", want: false},
+
+		// variables, selectors and functions
+		{expr: "$rec.key[0] + $rec.value[1]", want: int64(3)},
+		{expr: `$rec.value[0] + "y"`, want: "xy"},
+		{expr: "len($s) + 1", want: int64(4)},
+		{expr: "int(2.9)", want: int64(2)},
+		{expr: `str(1) + str(2)`, want: "12"},
+		{expr: `contains($s, "b") && prefix($s, "ab")`, want: true},
+		{expr: `${s} + "d"`, want: "abcd"},
+		{expr: `'a\n' == "a\\n"`, want: true},
+		{expr: "0x10", want: int64(16)},
+	}
+
+	for _, tt := range tests {
+		got, err := r.eval(tt.expr)
+		if err != nil {
+			t.Errorf("%s: %s", tt.expr, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %#v, want %#v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestEvalInvalid(t *testing.T) {
+	r := newTestHandler(map[string]any{"s": "abc"})
+
+	for _, expr := range []string{
+		"",
+		"1 +",
+		"(1",
+		"1 2",
+		"1 < 2 < 3",
+		"1 / 0",
+		"1 % 0",
+		`"a" - 1`,
+		"$s < 1",
+		"$undefined",
+		"true && $undefined",
+		"foo",
+		"foo()",
+		"len(1, 2)",
+		"len(1",
+		`"unterminated`,
+		"${s",
+		"$",
+		"1 & 2",
+	} {
+		if v, err := r.eval(expr); err == nil {
+			t.Errorf("%q = %#v, want an error", expr, v)
+		}
+	}
+}
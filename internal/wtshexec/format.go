@@ -0,0 +1,363 @@
+package wtshexec
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"wtsh/internal/wtshmsg"
+)
+
+// schema describes the fields of a table, so arguments can be converted to
+// the right types and results get column names.
+type schema struct {
+	uri         string
+	keyFormat   []byte
+	valueFormat []byte
+	columns     []string
+}
+
+// header names the columns of rec, falling back to key0.. and value0.. when
+// the table has no columns configured.
+func (s schema) header(rec record) []wtshmsg.Column {
+	named := s.named()
+
+	columns := make([]wtshmsg.Column, 0, len(rec.Key)+len(rec.Value))
+
+	for i := range rec.Key {
+		c := wtshmsg.Column{Name: fmt.Sprintf("key%d", i)}
+
+		if i < len(s.keyFormat) {
+			c.Type = string(s.keyFormat[i])
+
+			if named {
+				c.Name = s.columns[i]
+			}
+		}
+
+		columns = append(columns, c)
+	}
+
+	for i := range rec.Value {
+		c := wtshmsg.Column{Name: fmt.Sprintf("value%d", i)}
+
+		if i < len(s.valueFormat) {
+			c.Type = string(s.valueFormat[i])
+
+			if named {
+				c.Name = s.columns[len(s.keyFormat)+i]
+			}
+		}
+
+		columns = append(columns, c)
+	}
+
+	return columns
+}
+
+// parseSchema reads the formats and columns from a table's configuration.
+func parseSchema(uri, config string) (schema, error) {
+	sch := schema{uri: uri}
+
+	kf, ok := configValue(config, "key_format")
+	if !ok {
+		return sch, fmt.Errorf("no key_format")
+	}
+
+	vf, ok := configValue(config, "value_format")
+	if !ok {
+		return sch, fmt.Errorf("no value_format")
+	}
+
+	keyFormat, err := parseFormat(kf)
+	if err != nil {
+		return sch, fmt.Errorf("key format: %w", err)
+	}
+
+	valueFormat, err := parseFormat(vf)
+	if err != nil {
+		return sch, fmt.Errorf("value format: %w", err)
+	}
+
+	sch.keyFormat = keyFormat
+	sch.valueFormat = valueFormat
+
+	if columns, ok := configValue(config, "columns"); ok {
+		sch.columns = parseColumns(columns)
+	}
+
+	return sch, nil
+}
+
+func (s schema) named() bool {
+	return len(s.columns) > 0 && len(s.columns) == len(s.keyFormat)+len(s.valueFormat)
+}
+
+func (s schema) keyColumns() []string {
+	if !s.named() {
+		return nil
+	}
+
+	return s.columns[:len(s.keyFormat)]
+}
+
+func (s schema) valueColumns() []string {
+	if !s.named() {
+		return nil
+	}
+
+	return s.columns[len(s.keyFormat):]
+}
+
+// column returns the format character of a named column.
+func (s schema) column(name string) (byte, bool) {
+	if !s.named() {
+		return 0, false
+	}
+
+	for i, c := range s.columns {
+		if c != name {
+			continue
+		}
+
+		if i < len(s.keyFormat) {
+			return s.keyFormat[i], true
+		}
+
+		return s.valueFormat[i-len(s.keyFormat)], true
+	}
+
+	return 0, false
+}
+
+// project builds the schema of a cursor returning the given columns of s as
+// its key and value, such as an index or a projection.
+func (s schema) project(keyColumns, valueColumns []string) (schema, error) {
+	if !s.named() {
+		return schema{}, fmt.Errorf("'%s' has no named columns", s.uri)
+	}
+
+	p := schema{
+		uri:         s.uri,
+		keyFormat:   make([]byte, 0, len(keyColumns)),
+		valueFormat: make([]byte, 0, len(valueColumns)),
+		columns:     append(append([]string{}, keyColumns...), valueColumns...),
+	}
+
+	for _, c := range keyColumns {
+		t, ok := s.column(c)
+		if !ok {
+			return schema{}, fmt.Errorf("'%s' has no column '%s'", s.uri, c)
+		}
+
+		p.keyFormat = append(p.keyFormat, t)
+	}
+
+	for _, c := range valueColumns {
+		t, ok := s.column(c)
+		if !ok {
+			return schema{}, fmt.Errorf("'%s' has no column '%s'", s.uri, c)
+		}
+
+		p.valueFormat = append(p.valueFormat, t)
+	}
+
+	return p, nil
+}
+
+// splitProjection splits "table:foo(a,b)" into "table:foo" and its columns.
+// projected is false when uri has no projection.
+func splitProjection(uri string) (base string, columns []string, projected bool) {
+	i := strings.IndexByte(uri, '(')
+	if i < 0 || !strings.HasSuffix(uri, ")") {
+		return uri, nil, false
+	}
+
+	return uri[:i], parseColumns(uri[i:]), true
+}
+
+// tableURI returns the table that an index, column group or projection reads
+// from, so settings made for the table apply to them too.
+func tableURI(uri string) string {
+	base, _, _ := splitProjection(uri)
+
+	for _, prefix := range []string{"index:", "colgroup:"} {
+		if name, ok := strings.CutPrefix(base, prefix); ok {
+			name, _, _ = strings.Cut(name, ":")
+			return "table:" + name
+		}
+	}
+
+	return base
+}
+
+// parseColumns splits a columns=(a,b,c) configuration value into names.
+func parseColumns(v string) []string {
+	v = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(v), "("), ")")
+
+	if strings.TrimSpace(v) == "" {
+		return nil
+	}
+
+	names := strings.Split(v, ",")
+	for i, n := range names {
+		names[i] = strings.TrimSpace(n)
+	}
+
+	return names
+}
+
+// parseFormat expands a WiredTiger format string into one type character per
+// field, e.g. "3qS" becomes "qqqS". Sizes on 's', 'S' and 'u' describe the
+// field width rather than a repeat count.
+func parseFormat(format string) ([]byte, error) {
+	fields := make([]byte, 0, len(format))
+
+	format = strings.TrimLeft(format, "@<>!=.")
+
+	size := 0
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+
+		if c >= '0' && c <= '9' {
+			size = size*10 + int(c-'0')
+			continue
+		}
+
+		switch c {
+		case 'x':
+		case 's', 'S', 'u':
+			fields = append(fields, c)
+		case 'b', 'B', 'h', 'H', 'i', 'I', 'l', 'L', 'q', 'Q', 'r', 't':
+			n := size
+			if n == 0 {
+				n = 1
+			}
+
+			for j := 0; j < n; j++ {
+				fields = append(fields, c)
+			}
+		default:
+			return nil, fmt.Errorf("'%c' is not a supported format directive", c)
+		}
+
+		size = 0
+	}
+
+	return fields, nil
+}
+
+func convertField(v any, t byte) (any, error) {
+	s, ok := v.(string)
+	if !ok {
+		return convertTyped(v, t)
+	}
+
+	switch t {
+	case 's', 'S':
+		return s, nil
+	case 'u':
+		return []byte(s), nil
+	case 'b':
+		n, err := strconv.ParseInt(s, 0, 8)
+		return int8(n), err
+	case 'B', 't':
+		n, err := strconv.ParseUint(s, 0, 8)
+		return uint8(n), err
+	case 'h':
+		n, err := strconv.ParseInt(s, 0, 16)
+		return int16(n), err
+	case 'H':
+		n, err := strconv.ParseUint(s, 0, 16)
+		return uint16(n), err
+	case 'i', 'l':
+		n, err := strconv.ParseInt(s, 0, 32)
+		return int32(n), err
+	case 'I', 'L':
+		n, err := strconv.ParseUint(s, 0, 32)
+		return uint32(n), err
+	case 'q':
+		return strconv.ParseInt(s, 0, 64)
+	case 'Q', 'r':
+		return strconv.ParseUint(s, 0, 64)
+	}
+
+	return nil, fmt.Errorf("'%c' is not a supported format directive", t)
+}
+
+func convertTyped(v any, t byte) (any, error) {
+	switch t {
+	case 's', 'S':
+		return formatValue(v), nil
+	case 'u':
+		if b, ok := v.([]byte); ok {
+			return b, nil
+		}
+
+		return []byte(formatValue(v)), nil
+	}
+
+	return convertField(formatValue(v), t)
+}
+
+func convertFields(args []any, format []byte) ([]any, error) {
+	// unknown format, let wtgo decide
+	if format == nil {
+		return args, nil
+	}
+
+	if len(args) != len(format) {
+		return nil, fmt.Errorf("expected %d fields, got %d", len(format), len(args))
+	}
+
+	fields := make([]any, len(args))
+
+	for i, a := range args {
+		f, err := convertField(a, format[i])
+		if err != nil {
+			return nil, fmt.Errorf("field %d: %w", i, err)
+		}
+
+		fields[i] = f
+	}
+
+	return fields, nil
+}
+
+// configValue returns the value for key in a WiredTiger configuration string,
+// keeping nested parentheses intact.
+func configValue(config, key string) (string, bool) {
+	for _, kv := range splitConfig(config) {
+		k, v, _ := strings.Cut(kv, "=")
+		if strings.TrimSpace(k) == key {
+			return strings.TrimSpace(v), true
+		}
+	}
+
+	return "", false
+}
+
+func splitConfig(config string) []string {
+	parts := make([]string, 0, 8)
+
+	depth := 0
+	start := 0
+	for i := 0; i < len(config); i++ {
+		switch config[i] {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, config[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	if start < len(config) {
+		parts = append(parts, config[start:])
+	}
+
+	return parts
+}
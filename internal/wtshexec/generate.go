@@ -0,0 +1,459 @@
+package wtshexec
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+	"wtsh/internal/wtshmsg"
+
+	"github.com/dylrich/wtgo"
+)
+
+const generateUsage = "parse: generate <uri> --count n [--key seq|random|uuid] [--value template] [--seed n] [--start n] [--batch n]"
+
+// A generator makes the field of record i for a column of format.
+type generator func(rng *rand.Rand, i int64) any
+
+// generate implements the generate command, filling uri with count records
+// made from the key generator and the value template. The same seed always
+// gives the same records. Records are committed every batch unless a
+// transaction is already running, in which case they are left to it.
+func (r *ConnectionHandler) generate(args string) error {
+	fields := strings.Fields(args)
+
+	if len(fields) == 0 {
+		return fmt.Errorf(generateUsage)
+	}
+
+	uri := fields[0]
+	key, template := "seq", ""
+
+	var count, start int64
+	seed, batch := int64(1), int64(1000)
+
+	for i := 1; i < len(fields); i++ {
+		if i+1 >= len(fields) {
+			return fmt.Errorf("parse: %s requires a value", fields[i])
+		}
+
+		v := fields[i+1]
+
+		var err error
+
+		switch fields[i] {
+		case "--count":
+			count, err = strconv.ParseInt(v, 10, 64)
+		case "--key":
+			key = v
+		case "--value":
+			template = v
+		case "--seed":
+			seed, err = strconv.ParseInt(v, 10, 64)
+		case "--start":
+			start, err = strconv.ParseInt(v, 10, 64)
+		case "--batch":
+			batch, err = strconv.ParseInt(v, 10, 64)
+			if err == nil && batch < 1 {
+				err = fmt.Errorf("must be at least 1")
+			}
+		default:
+			return fmt.Errorf("parse: unknown option '%s'", fields[i])
+		}
+
+		if err != nil {
+			return fmt.Errorf("parse: %s: %w", fields[i], err)
+		}
+
+		i++
+	}
+
+	if count < 1 {
+		return fmt.Errorf(generateUsage)
+	}
+
+	sch, err := r.schema(uri)
+	if err != nil {
+		return fmt.Errorf("generate: %w", err)
+	}
+
+	if sch.keyFormat == nil || sch.valueFormat == nil {
+		return fmt.Errorf("generate: the format of '%s' is unknown", uri)
+	}
+
+	keys := make([]generator, len(sch.keyFormat))
+	for i, f := range sch.keyFormat {
+		if keys[i], err = keyGenerator(key, f, start); err != nil {
+			return fmt.Errorf("generate: key: %w", err)
+		}
+	}
+
+	values, err := valueGenerators(template, sch)
+	if err != nil {
+		return fmt.Errorf("generate: value: %w", err)
+	}
+
+	cursor, err := r.state.session.OpenCursor(uri, "")
+	if err != nil {
+		return fmt.Errorf("generate: open cursor: %w", err)
+	}
+	defer cursor.Close()
+
+	rng := rand.New(rand.NewSource(seed))
+	session := r.state.session
+	batched := !r.state.transaction
+
+	started := time.Now()
+	reported := started
+
+	var done int64
+
+	for done < count {
+		// stop between batches, keeping the ones already committed
+		if r.interrupted() {
+			return fmt.Errorf("generate: interrupted after %d records", done)
+		}
+
+		if batched {
+			if err := session.BeginTransaction(""); err != nil {
+				return fmt.Errorf("generate: begin transaction: %w", err)
+			}
+		}
+
+		n := min(batch, count-done)
+
+		for i := done; i < done+n; i++ {
+			if err := insertGenerated(cursor, rng, i, keys, values, sch); err != nil {
+				if batched {
+					if rerr := session.RollbackTransaction(""); rerr != nil {
+						r.logger.Printf("generate: rollback transaction: %s\n", rerr)
+					}
+				}
+
+				return fmt.Errorf("generate: record %d (%d written): %w", i, done, err)
+			}
+		}
+
+		if batched {
+			if err := session.CommitTransaction(""); err != nil {
+				return fmt.Errorf("generate: commit transaction (%d written): %w", done, err)
+			}
+		}
+
+		done += n
+
+		if done < count && time.Since(reported) >= time.Second {
+			reported = time.Now()
+			r.handler.HandleMessage(wtshmsg.GenerateProgressMessage{URI: uri, Done: done, Count: count})
+		}
+	}
+
+	r.handler.HandleMessage(wtshmsg.GenerateMessage{URI: uri, Count: count, Seed: seed, Elapsed: time.Since(started)})
+
+	return nil
+}
+
+func insertGenerated(cursor *wtgo.Cursor, rng *rand.Rand, i int64, keys, values []generator, sch schema) error {
+	k := make([]any, len(keys))
+	for j, g := range keys {
+		f, err := convertField(g(rng, i), sch.keyFormat[j])
+		if err != nil {
+			return fmt.Errorf("key %d: %w", j, err)
+		}
+
+		k[j] = f
+	}
+
+	v := make([]any, len(values))
+	for j, g := range values {
+		f, err := convertField(g(rng, i), sch.valueFormat[j])
+		if err != nil {
+			return fmt.Errorf("value %d: %w", j, err)
+		}
+
+		v[j] = f
+	}
+
+	// a failed insert leaves the key and value buffered in wtgo
+	err := cursor.SetKey(k...)
+	if err == nil {
+		err = cursor.SetValue(v...)
+	}
+
+	if err == nil {
+		err = cursor.Insert()
+	}
+
+	if err != nil {
+		cursor.Reset()
+	}
+
+	return err
+}
+
+func keyGenerator(name string, format byte, start int64) (generator, error) {
+	numeric := format != 'S' && format != 's' && format != 'u'
+
+	switch name {
+	case "seq":
+		if format == 'r' {
+			// record numbers start at 1
+			start++
+		}
+
+		if numeric {
+			return func(_ *rand.Rand, i int64) any { return start + i }, nil
+		}
+
+		// zero padded so the keys sort in the order they were made
+		return func(_ *rand.Rand, i int64) any { return fmt.Sprintf("%012d", start+i) }, nil
+	case "random":
+		if numeric {
+			lo, hi := formatRange(format)
+			if format == 'r' {
+				lo = 1
+			}
+
+			return intGenerator(lo, hi), nil
+		}
+
+		return stringGenerator(16), nil
+	case "uuid":
+		if numeric {
+			return nil, fmt.Errorf("uuid keys need an S or u column")
+		}
+
+		return uuid, nil
+	}
+
+	return nil, fmt.Errorf("'%s' is not a key generator, expected seq, random or uuid", name)
+}
+
+// valueGenerators parses a template of one generator per value column,
+// separated by commas:
+//
+//	int(lo,hi)         a random integer in [lo, hi]
+//	string(n)          n random letters
+//	bytes(n)           n random bytes
+//	timestamp[(a,b)]   a random time in [a, b), RFC 3339 or YYYY-MM-DD,
+//	                   as Unix seconds for integer columns
+//	seq                the record number
+//	uuid               a random UUID
+//	const(text)        always text
+//
+// Without a template each column gets a generator that suits its format.
+func valueGenerators(template string, sch schema) ([]generator, error) {
+	if template == "" {
+		gens := make([]generator, len(sch.valueFormat))
+
+		for i, f := range sch.valueFormat {
+			switch f {
+			case 'S', 's':
+				gens[i] = stringGenerator(16)
+			case 'u':
+				gens[i] = bytesGenerator(16)
+			default:
+				gens[i] = intGenerator(formatRange(f))
+			}
+		}
+
+		return gens, nil
+	}
+
+	specs := splitConfig(template)
+	if len(specs) != len(sch.valueFormat) {
+		return nil, fmt.Errorf("template has %d generators for %d columns", len(specs), len(sch.valueFormat))
+	}
+
+	gens := make([]generator, len(specs))
+
+	for i, spec := range specs {
+		g, err := parseGenerator(strings.TrimSpace(spec), sch.valueFormat[i])
+		if err != nil {
+			return nil, fmt.Errorf("'%s': %w", spec, err)
+		}
+
+		gens[i] = g
+	}
+
+	return gens, nil
+}
+
+func parseGenerator(spec string, format byte) (generator, error) {
+	name, args := spec, []string{}
+
+	if open := strings.IndexByte(spec, '('); open >= 0 {
+		if !strings.HasSuffix(spec, ")") {
+			return nil, fmt.Errorf("missing ')'")
+		}
+
+		name = spec[:open]
+		args = strings.Split(spec[open+1:len(spec)-1], ",")
+	}
+
+	switch name {
+	case "int":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("expected int(lo,hi)")
+		}
+
+		lo, err := strconv.ParseInt(strings.TrimSpace(args[0]), 0, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		hi, err := strconv.ParseInt(strings.TrimSpace(args[1]), 0, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		if hi < lo {
+			return nil, fmt.Errorf("%d is less than %d", hi, lo)
+		}
+
+		return intGenerator(lo, hi), nil
+	case "string", "bytes":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("expected %s(n)", name)
+		}
+
+		n, err := strconv.Atoi(strings.TrimSpace(args[0]))
+		if err != nil {
+			return nil, err
+		}
+
+		if n < 0 {
+			return nil, fmt.Errorf("length must not be negative")
+		}
+
+		if name == "bytes" {
+			return bytesGenerator(n), nil
+		}
+
+		return stringGenerator(n), nil
+	case "timestamp":
+		from := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		to := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		if len(args) != 0 {
+			if len(args) != 2 {
+				return nil, fmt.Errorf("expected timestamp(from,to)")
+			}
+
+			var err error
+
+			if from, err = parseTime(args[0]); err != nil {
+				return nil, err
+			}
+
+			if to, err = parseTime(args[1]); err != nil {
+				return nil, err
+			}
+
+			if !to.After(from) {
+				return nil, fmt.Errorf("%s is not after %s", args[1], args[0])
+			}
+		}
+
+		numeric := format != 'S' && format != 's' && format != 'u'
+		span := to.Sub(from)
+
+		return func(rng *rand.Rand, _ int64) any {
+			t := from.Add(time.Duration(rng.Int63n(int64(span))))
+
+			if numeric {
+				return t.Unix()
+			}
+
+			return t.Format(time.RFC3339)
+		}, nil
+	case "seq":
+		return func(_ *rand.Rand, i int64) any { return i }, nil
+	case "uuid":
+		return uuid, nil
+	case "const":
+		text := strings.Join(args, ",")
+		return func(*rand.Rand, int64) any { return text }, nil
+	}
+
+	return nil, fmt.Errorf("'%s' is not a generator, expected int, string, bytes, timestamp, seq, uuid or const", name)
+}
+
+func parseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+
+	return time.Parse(time.RFC3339, s)
+}
+
+// formatRange is the range of values a column of an integer format holds.
+func formatRange(format byte) (int64, int64) {
+	switch format {
+	case 'b':
+		return math.MinInt8, math.MaxInt8
+	case 'B', 't':
+		return 0, math.MaxUint8
+	case 'h':
+		return math.MinInt16, math.MaxInt16
+	case 'H':
+		return 0, math.MaxUint16
+	case 'i', 'l':
+		return math.MinInt32, math.MaxInt32
+	case 'I', 'L':
+		return 0, math.MaxUint32
+	case 'Q', 'r':
+		return 0, math.MaxInt64
+	}
+
+	return math.MinInt64, math.MaxInt64
+}
+
+func intGenerator(lo, hi int64) generator {
+	return func(rng *rand.Rand, _ int64) any {
+		// the span overflows an int64 for the widest ranges
+		span := uint64(hi) - uint64(lo)
+		if span == math.MaxUint64 {
+			return int64(rng.Uint64())
+		}
+
+		return lo + int64(rng.Uint64()%(span+1))
+	}
+}
+
+func stringGenerator(n int) generator {
+	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+	return func(rng *rand.Rand, _ int64) any {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = letters[rng.Intn(len(letters))]
+		}
+
+		return string(b)
+	}
+}
+
+func bytesGenerator(n int) generator {
+	return func(rng *rand.Rand, _ int64) any {
+		b := make([]byte, n)
+		rng.Read(b)
+
+		return b
+	}
+}
+
+// uuid makes a version 4 UUID from rng so it follows the seed.
+func uuid(rng *rand.Rand, _ int64) any {
+	var b [16]byte
+	rng.Read(b[:])
+
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
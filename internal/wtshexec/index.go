@@ -0,0 +1,138 @@
+package wtshexec
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"wtsh/internal/wtshmsg"
+)
+
+// createSubordinate implements create-index and create-colgroup
+// <table> <name> <columns> [config], where columns is a comma separated list.
+func (r *ConnectionHandler) createSubordinate(kind, args string) error {
+	parts := strings.SplitN(args, " ", 4)
+
+	if len(parts) < 3 {
+		return fmt.Errorf("parse: create-%s <table> <name> <columns> [config]", kind)
+	}
+
+	table := strings.TrimPrefix(parts[0], "table:")
+	uri := fmt.Sprintf("%s:%s:%s", kind, table, parts[1])
+
+	config := fmt.Sprintf("columns=(%s)", strings.Trim(parts[2], "()"))
+	if len(parts) == 4 {
+		config += "," + parts[3]
+	}
+
+	if err := r.state.session.Create(uri, config); err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+
+	r.handler.HandleMessage(wtshmsg.CreateMessage{Name: uri})
+
+	return nil
+}
+
+// describe implements describe <uri>, listing the columns of a table along
+// with its column groups and indexes.
+func (r *ConnectionHandler) describe(uri string) error {
+	if uri == "" || strings.Contains(uri, " ") {
+		return fmt.Errorf("parse: describe <uri>")
+	}
+
+	if !strings.Contains(uri, ":") {
+		uri = "table:" + uri
+	}
+
+	sch, err := r.schema(uri)
+	if err != nil {
+		return fmt.Errorf("describe: %w", err)
+	}
+
+	rows := make([][]string, 0, len(sch.columns)+4)
+
+	fields := sch.header(record{Key: make([]any, len(sch.keyFormat)), Value: make([]any, len(sch.valueFormat))})
+
+	for i, c := range fields {
+		kind := "value"
+		if i < len(sch.keyFormat) {
+			kind = "key"
+		}
+
+		rows = append(rows, []string{kind, c.Name, c.Type, ""})
+	}
+
+	// column groups and indexes only belong to tables
+	if base, _, _ := splitProjection(uri); strings.HasPrefix(base, "table:") {
+		subordinates, err := r.subordinates(strings.TrimPrefix(base, "table:"))
+		if err != nil {
+			return fmt.Errorf("describe: %w", err)
+		}
+
+		for _, s := range subordinates {
+			types := make([]byte, 0, len(s.columns))
+
+			for _, c := range s.columns {
+				if t, ok := sch.column(c); ok {
+					types = append(types, t)
+				}
+			}
+
+			rows = append(rows, []string{s.kind, s.name, string(types), strings.Join(s.columns, ",")})
+		}
+	}
+
+	columns := []wtshmsg.Column{{Name: "kind", Type: "S"}, {Name: "name", Type: "S"}, {Name: "type", Type: "S"}, {Name: "columns", Type: "S"}}
+
+	r.handler.HandleMessage(wtshmsg.ResultMessage{Columns: columns, Rows: rows, Keys: 2})
+
+	return nil
+}
+
+type subordinate struct {
+	kind    string
+	name    string
+	columns []string
+}
+
+// subordinates finds the named column groups and indexes of a table in the
+// metadata, column groups first.
+func (r *ConnectionHandler) subordinates(table string) ([]subordinate, error) {
+	meta, err := r.state.session.OpenCursor("metadata:", "")
+	if err != nil {
+		return nil, fmt.Errorf("open metadata cursor: %w", err)
+	}
+	defer meta.Close()
+
+	found := make([]subordinate, 0)
+
+	for meta.Next() {
+		rec, err := r.readRecord(meta)
+		if err != nil {
+			return nil, err
+		}
+
+		uri := formatValue(rec.Key[0])
+
+		for _, kind := range []string{"colgroup", "index"} {
+			name, ok := strings.CutPrefix(uri, kind+":"+table+":")
+			if !ok {
+				continue
+			}
+
+			columns, _ := configValue(formatValue(rec.Value[0]), "columns")
+
+			found = append(found, subordinate{kind: kind, name: name, columns: parseColumns(columns)})
+		}
+	}
+
+	if err := meta.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].kind < found[j].kind
+	})
+
+	return found, nil
+}
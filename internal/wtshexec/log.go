@@ -0,0 +1,498 @@
+package wtshexec
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"wtsh/internal/wtshmsg"
+)
+
+const logFollowInterval = 500 * time.Millisecond
+
+var logRecordTypes = map[uint32]string{
+	0: "checkpoint",
+	1: "commit",
+	2: "file_sync",
+	3: "message",
+	6: "system",
+}
+
+var logOpTypes = map[uint32]string{
+	1:  "col_put",
+	2:  "col_remove",
+	3:  "col_truncate",
+	4:  "row_put",
+	5:  "row_remove",
+	6:  "row_truncate",
+	7:  "checkpoint_start",
+	8:  "prev_lsn",
+	9:  "col_modify",
+	10: "row_modify",
+	11: "txn_timestamp",
+	12: "backup_id",
+}
+
+// logOpIgnore is set on operations that recovery skips.
+const logOpIgnore = 0x80000000
+
+var logColumns = []wtshmsg.Column{
+	{Name: "lsn", Type: "S"},
+	{Name: "txnid", Type: "q"},
+	{Name: "rectype", Type: "S"},
+	{Name: "optype", Type: "S"},
+	{Name: "fileid", Type: "I"},
+	{Name: "uri", Type: "S"},
+	{Name: "key", Type: "u"},
+	{Name: "value", Type: "u"},
+}
+
+// lsn is a log cursor key: the log file, the offset in it and the operation
+// within the record.
+type lsn [3]uint32
+
+func (l lsn) before(o lsn) bool {
+	for i := range l {
+		if l[i] != o[i] {
+			return l[i] < o[i]
+		}
+	}
+
+	return false
+}
+
+func (l lsn) String() string {
+	return fmt.Sprintf("%d/%d/%d", l[0], l[1], l[2])
+}
+
+// parseLSN reads <file>/<offset>[/<counter>], where a missing counter is the
+// first operation of the record.
+func parseLSN(s string) (lsn, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 && len(parts) != 3 {
+		return lsn{}, fmt.Errorf("parse: lsn '%s' is not <file>/<offset>[/<counter>]", s)
+	}
+
+	var l lsn
+
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return lsn{}, fmt.Errorf("parse: lsn %s: %w", []string{"file", "offset", "counter"}[i], err)
+		}
+
+		l[i] = uint32(n)
+	}
+
+	return l, nil
+}
+
+// logFile is a file: entry from the metadata, for decoding operations on it.
+type logFile struct {
+	uri         string
+	keyFormat   string
+	valueFormat string
+}
+
+// logReader turns log cursor records into result rows.
+type logReader struct {
+	filter    string
+	files     map[uint32]logFile
+	refreshed bool
+}
+
+type logFollow struct {
+	reader  *logReader
+	last    *lsn
+	handler MessageHandler
+	stop    chan struct{}
+	once    sync.Once
+}
+
+func (f *logFollow) close() {
+	f.once.Do(func() {
+		close(f.stop)
+	})
+}
+
+// logCommand implements log [--from lsn] [--follow] [--filter optype]
+// [--limit n] and log --stop.
+func (r *ConnectionHandler) logCommand(args string) error {
+	fields := strings.Fields(args)
+
+	var from *lsn
+	var filter string
+	var follow bool
+	limit := -1
+
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "--follow":
+			follow = true
+			continue
+		case "--stop":
+			if len(fields) != 1 {
+				return fmt.Errorf("parse: log --stop")
+			}
+
+			r.stopFollow()
+
+			return nil
+		}
+
+		if i+1 >= len(fields) {
+			return fmt.Errorf("parse: %s requires a value", fields[i])
+		}
+
+		switch fields[i] {
+		case "--from":
+			l, err := parseLSN(fields[i+1])
+			if err != nil {
+				return err
+			}
+
+			from = &l
+		case "--filter":
+			filter = fields[i+1]
+		case "--limit":
+			n, err := strconv.Atoi(fields[i+1])
+			if err != nil {
+				return fmt.Errorf("parse: limit: %w", err)
+			}
+
+			limit = n
+		default:
+			return fmt.Errorf("parse: unknown option '%s'", fields[i])
+		}
+
+		i++
+	}
+
+	// nothing would stop the follow once the caller has gone, e.g. a
+	// client detaching from a server, and without Run nothing receives the
+	// polls, e.g. in a --script batch
+	if follow && (r.transient || r.done == nil) {
+		return fmt.Errorf("log: --follow is only supported in an interactive session")
+	}
+
+	start := time.Now()
+
+	reader := &logReader{filter: filter}
+
+	rows, last, err := r.readLog(reader, from, nil, limit)
+	if err != nil {
+		return err
+	}
+
+	r.handler.HandleMessage(wtshmsg.ResultMessage{Columns: logColumns, Rows: rows, Keys: 1, Elapsed: time.Since(start)})
+
+	if !follow {
+		return nil
+	}
+
+	r.stopFollow()
+
+	f := &logFollow{reader: reader, last: last, handler: r.handler, stop: make(chan struct{})}
+	r.state.follow = f
+
+	go func() {
+		ticker := time.NewTicker(logFollowInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-f.stop:
+				return
+			case <-ticker.C:
+			}
+
+			select {
+			case r.actions <- func() { r.followLog(f) }:
+			case <-f.stop:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (r *ConnectionHandler) stopFollow() {
+	if r.state.follow != nil {
+		r.state.follow.close()
+		r.state.follow = nil
+	}
+}
+
+// followLog reports records written since the last poll, to the handler
+// that started following.
+func (r *ConnectionHandler) followLog(f *logFollow) {
+	if r.state.follow != f || r.state.session == nil {
+		f.close()
+		return
+	}
+
+	rows, last, err := r.readLog(f.reader, f.last, f.last, -1)
+	if err != nil {
+		f.handler.HandleMessage(err)
+		r.stopFollow()
+
+		return
+	}
+
+	if last != nil {
+		f.last = last
+	}
+
+	if len(rows) > 0 {
+		f.handler.HandleMessage(wtshmsg.ResultMessage{Columns: logColumns, Rows: rows, Keys: 1})
+	}
+}
+
+// readLog reads up to limit records starting at from, or the start of the
+// log, skipping anything up to and including after. It returns the key of
+// the last record read, or nil if there were none.
+func (r *ConnectionHandler) readLog(reader *logReader, from, after *lsn, limit int) ([][]string, *lsn, error) {
+	cursor, err := r.state.session.OpenCursor("log:", "")
+	if err != nil {
+		return nil, nil, fmt.Errorf("open log cursor: %w", err)
+	}
+	defer cursor.Close()
+
+	var ok bool
+
+	if from != nil {
+		if err := cursor.SetKey(from[0], from[1], uint32(0)); err != nil {
+			return nil, nil, fmt.Errorf("set key: %w", err)
+		}
+
+		ok = cursor.Search() == nil
+
+		// the record may have been archived since, so fall back to
+		// skipping ahead from the start
+		if !ok && after != nil {
+			if err := cursor.Reset(); err != nil {
+				return nil, nil, fmt.Errorf("reset: %w", err)
+			}
+
+			ok = cursor.Next()
+		} else if !ok {
+			return nil, nil, fmt.Errorf("no log record at %s", from)
+		}
+	} else {
+		ok = cursor.Next()
+	}
+
+	rows := make([][]string, 0)
+
+	var last *lsn
+
+	for ; ok && (limit < 0 || len(rows) < limit); ok = cursor.Next() {
+		rec, err := r.readRecord(cursor)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		key, err := logKey(rec)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if after != nil && !after.before(key) {
+			continue
+		}
+
+		// the search lands on the first operation of the record
+		if from != nil && key.before(*from) {
+			continue
+		}
+
+		last = &key
+
+		if row, match := r.logRow(reader, key, rec); match {
+			rows = append(rows, row)
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return rows, last, nil
+}
+
+func logKey(rec record) (lsn, error) {
+	var key lsn
+
+	if len(rec.Key) != len(key) {
+		return key, fmt.Errorf("unexpected log key %v", rec.Key)
+	}
+
+	for i, k := range rec.Key {
+		n, _ := number(k)
+
+		v, ok := n.(int64)
+		if !ok {
+			return key, fmt.Errorf("unexpected log key %v", rec.Key)
+		}
+
+		key[i] = uint32(v)
+	}
+
+	return key, nil
+}
+
+// logRow lays out one operation, decoding its key and value with the formats
+// of the file it applies to. match is false if the filter leaves it out.
+func (r *ConnectionHandler) logRow(reader *logReader, key lsn, rec record) ([]string, bool) {
+	if len(rec.Value) != 6 {
+		return []string{key.String(), fmt.Sprintf("%v", rec.Value)}, reader.filter == ""
+	}
+
+	u32 := func(v any) uint32 {
+		n, _ := number(v)
+		i, _ := n.(int64)
+
+		return uint32(i)
+	}
+
+	rectype := u32(rec.Value[1])
+	optype := u32(rec.Value[2]) &^ logOpIgnore
+	fileid := u32(rec.Value[3])
+
+	rectypeName, ok := logRecordTypes[rectype]
+	if !ok {
+		rectypeName = strconv.FormatUint(uint64(rectype), 10)
+	}
+
+	var optypeName string
+
+	if rectype == 1 {
+		optypeName, ok = logOpTypes[optype]
+		if !ok {
+			optypeName = strconv.FormatUint(uint64(optype), 10)
+		}
+	}
+
+	if reader.filter != "" && reader.filter != optypeName && reader.filter != strconv.FormatUint(uint64(optype), 10) {
+		return nil, false
+	}
+
+	var file logFile
+	var keyFormat, valueFormat string
+
+	if rectype == 1 {
+		file = r.logFile(reader, fileid)
+
+		switch optypeName {
+		case "row_put", "row_remove", "row_modify", "row_truncate":
+			keyFormat = file.keyFormat
+		case "col_put", "col_remove", "col_modify", "col_truncate":
+			keyFormat = "r"
+		}
+
+		switch optypeName {
+		case "row_put", "col_put":
+			valueFormat = file.valueFormat
+		}
+	}
+
+	return []string{
+		key.String(),
+		formatValue(rec.Value[0]),
+		rectypeName,
+		optypeName,
+		strconv.FormatUint(uint64(fileid), 10),
+		file.uri,
+		r.formatLogField(rec.Value[4], keyFormat),
+		r.formatLogField(rec.Value[5], valueFormat),
+	}, true
+}
+
+// logFile looks up a file id, reading the metadata again once per reader if
+// it isn't known, since files may have been created since it was last read.
+func (r *ConnectionHandler) logFile(reader *logReader, id uint32) logFile {
+	if f, ok := reader.files[id]; ok || reader.refreshed {
+		return f
+	}
+
+	files, err := r.logFiles()
+	if err != nil {
+		r.logger.Printf("read metadata: %s\n", err)
+	}
+
+	reader.files = files
+	reader.refreshed = true
+
+	return files[id]
+}
+
+func (r *ConnectionHandler) logFiles() (map[uint32]logFile, error) {
+	// the metadata file doesn't list itself
+	files := map[uint32]logFile{0: {uri: "file:WiredTiger.wt", keyFormat: "S", valueFormat: "S"}}
+
+	cursor, err := r.state.session.OpenCursor("metadata:", "")
+	if err != nil {
+		return files, fmt.Errorf("open metadata cursor: %w", err)
+	}
+	defer cursor.Close()
+
+	for cursor.Next() {
+		rec, err := r.readRecord(cursor)
+		if err != nil {
+			return files, err
+		}
+
+		uri, _ := rec.Key[0].(string)
+		config, _ := rec.Value[0].(string)
+
+		if !strings.HasPrefix(uri, "file:") {
+			continue
+		}
+
+		id, ok := configValue(config, "id")
+		if !ok {
+			continue
+		}
+
+		n, err := strconv.ParseUint(id, 10, 32)
+		if err != nil {
+			continue
+		}
+
+		f := logFile{uri: uri, keyFormat: "u", valueFormat: "u"}
+
+		if v, ok := configValue(config, "key_format"); ok {
+			f.keyFormat = v
+		}
+
+		if v, ok := configValue(config, "value_format"); ok {
+			f.valueFormat = v
+		}
+
+		files[uint32(n)] = f
+	}
+
+	return files, cursor.Err()
+}
+
+// formatLogField renders packed bytes from a log record as typed fields when
+// the format is known, and as raw bytes otherwise.
+func (r *ConnectionHandler) formatLogField(v any, format string) string {
+	mode := r.display.mode("")
+
+	if b, ok := v.([]byte); ok && format != "" && len(b) > 0 {
+		if fields, err := unpackFields(format, b); err == nil {
+			cells := make([]string, len(fields))
+
+			for i, f := range fields {
+				cells[i] = formatDisplay(f, mode, true)
+			}
+
+			return strings.Join(cells, ", ")
+		}
+	}
+
+	return formatDisplay(v, mode, true)
+}
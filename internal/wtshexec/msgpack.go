@@ -0,0 +1,396 @@
+package wtshexec
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// msgpack maps become JSON objects, with non-string keys printed as text.
+// Binary data is shown as {"$binary": "<base64>"} and extension types as
+// {"$ext": {"type": n, "data": "<base64>"}}.
+type msgpackDecoder struct{}
+
+func newMsgpackDecoder(args []string) (decoder, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf("takes no arguments")
+	}
+
+	return msgpackDecoder{}, nil
+}
+
+func (msgpackDecoder) decode(b []byte) (any, error) {
+	v, n, err := readMsgpack(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if n != len(b) {
+		return nil, fmt.Errorf("%d trailing bytes after value", len(b)-n)
+	}
+
+	return v, nil
+}
+
+func readMsgpack(b []byte) (any, int, error) {
+	if len(b) == 0 {
+		return nil, 0, fmt.Errorf("unexpected end of data")
+	}
+
+	c := b[0]
+	b = b[1:]
+
+	switch {
+	case c <= 0x7f:
+		return int64(c), 1, nil
+	case c >= 0xe0:
+		return int64(int8(c)), 1, nil
+	case c >= 0x80 && c <= 0x8f:
+		return readMsgpackMap(b, int(c&0x0f), 1)
+	case c >= 0x90 && c <= 0x9f:
+		return readMsgpackArray(b, int(c&0x0f), 1)
+	case c >= 0xa0 && c <= 0xbf:
+		return readMsgpackBytes(b, int(c&0x1f), 1, true)
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, 1, nil
+	case 0xc2:
+		return false, 1, nil
+	case 0xc3:
+		return true, 1, nil
+	case 0xc4, 0xc5, 0xc6:
+		size := 1 << (c - 0xc4)
+
+		n, err := msgpackUint(b, size)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		return readMsgpackBytes(b[size:], int(n), 1+size, false)
+	case 0xd9, 0xda, 0xdb:
+		size := 1 << (c - 0xd9)
+
+		n, err := msgpackUint(b, size)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		return readMsgpackBytes(b[size:], int(n), 1+size, true)
+	case 0xc7, 0xc8, 0xc9:
+		size := 1 << (c - 0xc7)
+
+		n, err := msgpackUint(b, size)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		return readMsgpackExt(b[size:], int(n), 1+size)
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return readMsgpackExt(b, 1<<(c-0xd4), 1)
+	case 0xca:
+		n, err := msgpackUint(b, 4)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		return jsonFloat(math.Float32frombits(uint32(n))), 5, nil
+	case 0xcb:
+		n, err := msgpackUint(b, 8)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		return jsonFloat(math.Float64frombits(n)), 9, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		size := 1 << (c - 0xcc)
+
+		n, err := msgpackUint(b, size)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		return n, 1 + size, nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+
+		n, err := msgpackUint(b, size)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		// sign extend from the encoded width
+		shift := 64 - 8*size
+
+		return int64(n<<shift) >> shift, 1 + size, nil
+	case 0xdc, 0xdd:
+		size := 2 << (c - 0xdc)
+
+		n, err := msgpackUint(b, size)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		return readMsgpackArray(b[size:], int(n), 1+size)
+	case 0xde, 0xdf:
+		size := 2 << (c - 0xde)
+
+		n, err := msgpackUint(b, size)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		return readMsgpackMap(b[size:], int(n), 1+size)
+	}
+
+	return nil, 0, fmt.Errorf("unsupported type byte 0x%02x", c)
+}
+
+func msgpackUint(b []byte, size int) (uint64, error) {
+	if err := need(b, size); err != nil {
+		return 0, err
+	}
+
+	switch size {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	}
+
+	return binary.BigEndian.Uint64(b), nil
+}
+
+func readMsgpackBytes(b []byte, n, header int, str bool) (any, int, error) {
+	if err := need(b, n); err != nil {
+		return nil, 0, err
+	}
+
+	if str {
+		return string(b[:n]), header + n, nil
+	}
+
+	return document{{Name: "$binary", Value: base64.StdEncoding.EncodeToString(b[:n])}}, header + n, nil
+}
+
+func readMsgpackExt(b []byte, n, header int) (any, int, error) {
+	if err := need(b, n+1); err != nil {
+		return nil, 0, err
+	}
+
+	ext := document{
+		{Name: "type", Value: int8(b[0])},
+		{Name: "data", Value: base64.StdEncoding.EncodeToString(b[1 : 1+n])},
+	}
+
+	return document{{Name: "$ext", Value: ext}}, header + 1 + n, nil
+}
+
+func readMsgpackArray(b []byte, n, header int) (any, int, error) {
+	a := make([]any, 0, min(n, 1024))
+	size := header
+
+	for i := 0; i < n; i++ {
+		v, m, err := readMsgpack(b)
+		if err != nil {
+			return nil, 0, fmt.Errorf("[%d]: %w", i, err)
+		}
+
+		a = append(a, v)
+		b = b[m:]
+		size += m
+	}
+
+	return a, size, nil
+}
+
+func readMsgpackMap(b []byte, n, header int) (any, int, error) {
+	doc := make(document, 0, min(n, 1024))
+	size := header
+
+	for i := 0; i < n; i++ {
+		k, m, err := readMsgpack(b)
+		if err != nil {
+			return nil, 0, fmt.Errorf("key %d: %w", i, err)
+		}
+
+		b = b[m:]
+		size += m
+
+		v, m, err := readMsgpack(b)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%v: %w", k, err)
+		}
+
+		b = b[m:]
+		size += m
+
+		name, ok := k.(string)
+		if !ok {
+			name = fmt.Sprintf("%v", k)
+		}
+
+		doc = append(doc, field{Name: name, Value: v})
+	}
+
+	return doc, size, nil
+}
+
+func (msgpackDecoder) encode(data []byte) ([]byte, error) {
+	v, err := parseJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return appendMsgpack(nil, v)
+}
+
+func appendMsgpack(b []byte, v any) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xc0), nil
+	case bool:
+		if v {
+			return append(b, 0xc3), nil
+		}
+
+		return append(b, 0xc2), nil
+	case string:
+		n := len(v)
+
+		switch {
+		case n < 32:
+			b = append(b, 0xa0|byte(n))
+		case n <= math.MaxUint8:
+			b = append(b, 0xd9, byte(n))
+		case n <= math.MaxUint16:
+			b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+		default:
+			b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+		}
+
+		return append(b, v...), nil
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return appendMsgpackInt(b, n), nil
+		}
+
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+
+		return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(f)), nil
+	case []any:
+		n := len(v)
+
+		switch {
+		case n < 16:
+			b = append(b, 0x90|byte(n))
+		case n <= math.MaxUint16:
+			b = binary.BigEndian.AppendUint16(append(b, 0xdc), uint16(n))
+		default:
+			b = binary.BigEndian.AppendUint32(append(b, 0xdd), uint32(n))
+		}
+
+		for _, e := range v {
+			var err error
+
+			b, err = appendMsgpack(b, e)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return b, nil
+	case document:
+		if len(v) == 1 && v[0].Name == "$binary" {
+			s, _ := v[0].Value.(string)
+
+			data, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return nil, fmt.Errorf("$binary: %w", err)
+			}
+
+			n := len(data)
+
+			switch {
+			case n <= math.MaxUint8:
+				b = append(b, 0xc4, byte(n))
+			case n <= math.MaxUint16:
+				b = binary.BigEndian.AppendUint16(append(b, 0xc5), uint16(n))
+			default:
+				b = binary.BigEndian.AppendUint32(append(b, 0xc6), uint32(n))
+			}
+
+			return append(b, data...), nil
+		}
+
+		n := len(v)
+
+		switch {
+		case n < 16:
+			b = append(b, 0x80|byte(n))
+		case n <= math.MaxUint16:
+			b = binary.BigEndian.AppendUint16(append(b, 0xde), uint16(n))
+		default:
+			b = binary.BigEndian.AppendUint32(append(b, 0xdf), uint32(n))
+		}
+
+		for _, f := range v {
+			var err error
+
+			b, _ = appendMsgpack(b, f.Name)
+
+			b, err = appendMsgpack(b, f.Value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", f.Name, err)
+			}
+		}
+
+		return b, nil
+	}
+
+	return nil, fmt.Errorf("unsupported value %v", v)
+}
+
+func appendMsgpackInt(b []byte, n int64) []byte {
+	switch {
+	case n >= 0 && n <= 0x7f:
+		return append(b, byte(n))
+	case n < 0 && n >= -32:
+		return append(b, byte(int8(n)))
+	case n >= math.MinInt8 && n <= math.MaxInt8:
+		return append(b, 0xd0, byte(int8(n)))
+	case n >= math.MinInt16 && n <= math.MaxInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(n))
+	case n >= math.MinInt32 && n <= math.MaxInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(n))
+	}
+
+	return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(n))
+}
+
+// jsonFloat marshals non-finite values, which JSON has no numbers for, as
+// {"$numberDouble": "NaN"} and friends, as in BSON's extended JSON.
+type jsonFloat float64
+
+func (f jsonFloat) MarshalJSON() ([]byte, error) {
+	v := float64(f)
+
+	switch {
+	case math.IsNaN(v):
+		return []byte(`{"$numberDouble":"NaN"}`), nil
+	case math.IsInf(v, 1):
+		return []byte(`{"$numberDouble":"Infinity"}`), nil
+	case math.IsInf(v, -1):
+		return []byte(`{"$numberDouble":"-Infinity"}`), nil
+	}
+
+	return json.Marshal(v)
+}
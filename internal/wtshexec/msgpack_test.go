@@ -0,0 +1,152 @@
+package wtshexec
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMsgpackDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		want string
+	}{
+		{name: "positive fixint", in: []byte{0x7f}, want: `127`},
+		{name: "negative fixint", in: []byte{0xe0}, want: `-32`},
+		{name: "uint8", in: []byte{0xcc, 0xc8}, want: `200`},
+		{name: "uint16", in: []byte{0xcd, 0x01, 0x00}, want: `256`},
+		{name: "uint64", in: []byte{0xcf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, want: `18446744073709551615`},
+		{name: "int8", in: []byte{0xd0, 0x80}, want: `-128`},
+		{name: "int16", in: []byte{0xd1, 0xff, 0x38}, want: `-200`},
+		{name: "int32", in: []byte{0xd2, 0x80, 0x00, 0x00, 0x00}, want: `-2147483648`},
+		{name: "int64", in: []byte{0xd3, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe}, want: `-2`},
+		{name: "float32", in: []byte{0xca, 0x3f, 0xc0, 0x00, 0x00}, want: `1.5`},
+		{name: "float64", in: []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}, want: `1.5`},
+		{name: "nil and bools", in: []byte{0x93, 0xc0, 0xc2, 0xc3}, want: `[null,false,true]`},
+		{name: "fixstr", in: []byte{0xa2, 'h', 'i'}, want: `"hi"`},
+		{name: "str8", in: []byte{0xd9, 0x01, 'a'}, want: `"a"`},
+		{name: "bin8", in: []byte{0xc4, 0x02, 0x01, 0x02}, want: `{"$binary":"AQI="}`},
+		{name: "fixext1", in: []byte{0xd4, 0x01, 0x05}, want: `{"$ext":{"type":1,"data":"BQ=="}}`},
+		{name: "ext8", in: []byte{0xc7, 0x01, 0xff, 0x05}, want: `{"$ext":{"type":-1,"data":"BQ=="}}`},
+		{name: "fixmap", in: []byte{0x82, 0xa1, 'a', 0x01, 0xa1, 'b', 0x90}, want: `{"a":1,"b":[]}`},
+		{name: "integer map key", in: []byte{0x81, 0x07, 0xc3}, want: `{"7":true}`},
+		{name: "array16", in: []byte{0xdc, 0x00, 0x01, 0x05}, want: `[5]`},
+		{name: "map16", in: []byte{0xde, 0x00, 0x01, 0xa1, 'k', 0xc0}, want: `{"k":null}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := msgpackDecoder{}.decode(tt.in)
+			if err != nil {
+				t.Fatalf("decode: %s", err)
+			}
+
+			got, err := json.Marshal(v)
+			if err != nil {
+				t.Fatalf("marshal: %s", err)
+			}
+
+			if string(got) != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMsgpackDecodeMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+	}{
+		{name: "empty", in: nil},
+		{name: "never used", in: []byte{0xc1}},
+		{name: "truncated uint16", in: []byte{0xcd, 0x01}},
+		{name: "truncated float64", in: []byte{0xcb, 0x3f}},
+		{name: "truncated fixstr", in: []byte{0xa3, 'a'}},
+		{name: "truncated str8 length", in: []byte{0xd9}},
+		{name: "bin32 past end", in: []byte{0xc6, 0xff, 0xff, 0xff, 0xff, 0x00}},
+		{name: "truncated fixext", in: []byte{0xd5, 0x01, 0x00}},
+		{name: "array missing element", in: []byte{0x92, 0x01}},
+		{name: "map missing value", in: []byte{0x81, 0xa1, 'a'}},
+		{name: "huge array", in: []byte{0xdd, 0xff, 0xff, 0xff, 0xff}},
+		{name: "trailing bytes", in: []byte{0x01, 0x02}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if v, err := (msgpackDecoder{}).decode(tt.in); err == nil {
+				t.Errorf("decoded %v, want an error", v)
+			}
+		})
+	}
+}
+
+func TestMsgpackEncode(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []byte
+	}{
+		{in: `0`, want: []byte{0x00}},
+		{in: `127`, want: []byte{0x7f}},
+		{in: `128`, want: []byte{0xd1, 0x00, 0x80}},
+		{in: `-32`, want: []byte{0xe0}},
+		{in: `-33`, want: []byte{0xd0, 0xdf}},
+		{in: `-129`, want: []byte{0xd1, 0xff, 0x7f}},
+		{in: `65536`, want: []byte{0xd2, 0x00, 0x01, 0x00, 0x00}},
+		{in: `4294967296`, want: []byte{0xd3, 0, 0, 0, 0x01, 0, 0, 0, 0}},
+		{in: `1.5`, want: []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		{in: `"hi"`, want: []byte{0xa2, 'h', 'i'}},
+		{in: `[true,null]`, want: []byte{0x92, 0xc3, 0xc0}},
+		{in: `{"a":false}`, want: []byte{0x81, 0xa1, 'a', 0xc2}},
+		{in: `{"$binary":"AQI="}`, want: []byte{0xc4, 0x02, 0x01, 0x02}},
+	}
+
+	for _, tt := range tests {
+		got, err := msgpackDecoder{}.encode([]byte(tt.in))
+		if err != nil {
+			t.Errorf("%s: encode: %s", tt.in, err)
+			continue
+		}
+
+		if string(got) != string(tt.want) {
+			t.Errorf("%s: got % x, want % x", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	// past the fixstr and str8 limits
+	long := `"` + strings.Repeat("a", 300) + `"`
+
+	for _, in := range []string{
+		`{"a":1,"b":[true,null,"x"],"c":{"d":-300}}`,
+		`{"big":9223372036854775807,"small":-9223372036854775808}`,
+		`{"f":-0.25}`,
+		`{"bin":{"$binary":"AQI="}}`,
+		`[[],{},""]`,
+		long,
+	} {
+		b, err := msgpackDecoder{}.encode([]byte(in))
+		if err != nil {
+			t.Errorf("%s: encode: %s", in, err)
+			continue
+		}
+
+		v, err := msgpackDecoder{}.decode(b)
+		if err != nil {
+			t.Errorf("%s: decode: %s", in, err)
+			continue
+		}
+
+		got, err := json.Marshal(v)
+		if err != nil {
+			t.Errorf("%s: marshal: %s", in, err)
+			continue
+		}
+
+		if string(got) != in {
+			t.Errorf("got %s, want %s", got, in)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package wtshexec
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// unpackFields decodes bytes packed in WiredTiger's format, as found in log
+// records, into the same types wtgo returns from a cursor.
+func unpackFields(format string, b []byte) ([]any, error) {
+	fields := make([]any, 0, len(format))
+
+	format = strings.TrimLeft(format, "@<>!=.")
+
+	size, sized := 0, false
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+
+		if c >= '0' && c <= '9' {
+			size = size*10 + int(c-'0')
+			sized = true
+			continue
+		}
+
+		count := 1
+		if sized && !strings.ContainsRune("sSu", rune(c)) {
+			count = size
+		}
+
+		for ; count > 0; count-- {
+			var v any
+			n := 0
+
+			switch c {
+			case 'x':
+				n = 1
+			case 's':
+				n = 1
+				if sized {
+					n = size
+				}
+
+				if err := need(b, n); err != nil {
+					return nil, err
+				}
+
+				v = string(b[:n])
+			case 'S':
+				if sized {
+					n = size
+
+					if err := need(b, n); err != nil {
+						return nil, err
+					}
+
+					v, _, _ = strings.Cut(string(b[:n]), "\x00")
+					break
+				}
+
+				end := bytes.IndexByte(b, 0)
+				if end < 0 {
+					return nil, fmt.Errorf("unterminated string")
+				}
+
+				v, n = string(b[:end]), end+1
+			case 'u', 'U':
+				switch {
+				case c == 'u' && sized:
+					n = size
+				case c == 'u' && i == len(format)-1:
+					// the last field takes the rest without a length
+					n = len(b)
+				default:
+					l, m, err := unpackUint(b)
+					if err != nil {
+						return nil, err
+					}
+
+					b = b[m:]
+					n = int(l)
+				}
+
+				if err := need(b, n); err != nil {
+					return nil, err
+				}
+
+				v = append([]byte{}, b[:n]...)
+			case 'b':
+				if err := need(b, 1); err != nil {
+					return nil, err
+				}
+
+				v, n = int8(b[0]-0x80), 1
+			case 'B', 't':
+				if err := need(b, 1); err != nil {
+					return nil, err
+				}
+
+				v, n = b[0], 1
+			case 'h', 'i', 'l', 'q':
+				x, m, err := unpackInt(b)
+				if err != nil {
+					return nil, err
+				}
+
+				n = m
+
+				switch c {
+				case 'h':
+					v = int16(x)
+				case 'i', 'l':
+					v = int32(x)
+				default:
+					v = x
+				}
+			case 'H', 'I', 'L', 'Q', 'r':
+				x, m, err := unpackUint(b)
+				if err != nil {
+					return nil, err
+				}
+
+				n = m
+
+				switch c {
+				case 'H':
+					v = uint16(x)
+				case 'I', 'L':
+					v = uint32(x)
+				default:
+					v = x
+				}
+			default:
+				return nil, fmt.Errorf("'%c' is not a supported format directive", c)
+			}
+
+			if err := need(b, n); err != nil {
+				return nil, err
+			}
+
+			b = b[n:]
+
+			if c != 'x' {
+				fields = append(fields, v)
+			}
+		}
+
+		size, sized = 0, false
+	}
+
+	if len(b) != 0 {
+		return nil, fmt.Errorf("%d trailing bytes after fields", len(b))
+	}
+
+	return fields, nil
+}
+
+// unpackUint reads WiredTiger's variable length unsigned integer, where the
+// top bits of the first byte say how the rest is encoded.
+func unpackUint(b []byte) (uint64, int, error) {
+	if err := need(b, 1); err != nil {
+		return 0, 0, err
+	}
+
+	switch b[0] & 0xf0 {
+	case 0x80, 0x90, 0xa0, 0xb0:
+		return uint64(b[0] & 0x3f), 1, nil
+	case 0xc0, 0xd0:
+		if err := need(b, 2); err != nil {
+			return 0, 0, err
+		}
+
+		return (uint64(b[0]&0x1f)<<8 | uint64(b[1])) + 1<<6, 2, nil
+	case 0xe0:
+		n := int(b[0] & 0x0f)
+		if n > 8 {
+			break
+		}
+
+		if err := need(b, 1+n); err != nil {
+			return 0, 0, err
+		}
+
+		var x uint64
+		for _, c := range b[1 : 1+n] {
+			x = x<<8 | uint64(c)
+		}
+
+		return x + 1<<13 + 1<<6, 1 + n, nil
+	}
+
+	return 0, 0, fmt.Errorf("invalid packed unsigned integer 0x%02x", b[0])
+}
+
+func unpackInt(b []byte) (int64, int, error) {
+	if err := need(b, 1); err != nil {
+		return 0, 0, err
+	}
+
+	switch b[0] & 0xf0 {
+	case 0x10:
+		n := 8 - int(b[0]&0x0f)
+		if n < 0 {
+			return 0, 0, fmt.Errorf("invalid packed integer 0x%02x", b[0])
+		}
+
+		if err := need(b, 1+n); err != nil {
+			return 0, 0, err
+		}
+
+		x := ^uint64(0)
+		for _, c := range b[1 : 1+n] {
+			x = x<<8 | uint64(c)
+		}
+
+		return int64(x), 1 + n, nil
+	case 0x20, 0x30:
+		if err := need(b, 2); err != nil {
+			return 0, 0, err
+		}
+
+		return int64(uint64(b[0]&0x1f)<<8|uint64(b[1])) - 1<<13 - 1<<6, 2, nil
+	case 0x40, 0x50, 0x60, 0x70:
+		return int64(b[0]&0x3f) - 1<<6, 1, nil
+	}
+
+	x, n, err := unpackUint(b)
+
+	return int64(x), n, err
+}
+
+func need(b []byte, n int) error {
+	if len(b) < n {
+		return fmt.Errorf("expected %d bytes, got %d", n, len(b))
+	}
+
+	return nil
+}
@@ -0,0 +1,218 @@
+package wtshexec
+
+import (
+	"math"
+	"math/bits"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// packUint and packInt follow WiredTiger's intpack.i, to check the readers
+// against the encoding they undo.
+func packUint(x uint64) []byte {
+	switch {
+	case x < 1<<6:
+		return []byte{0x80 | byte(x)}
+	case x < 1<<13+1<<6:
+		x -= 1 << 6
+		return []byte{0xc0 | byte(x>>8), byte(x)}
+	}
+
+	x -= 1<<13 + 1<<6
+
+	n := 8 - bits.LeadingZeros64(x)/8
+	b := []byte{0xe0 | byte(n)}
+
+	for i := n - 1; i >= 0; i-- {
+		b = append(b, byte(x>>(8*i)))
+	}
+
+	return b
+}
+
+func packInt(x int64) []byte {
+	switch {
+	case x < -(1<<13 + 1<<6):
+		lz := bits.LeadingZeros64(^uint64(x)) / 8
+		b := []byte{0x10 | byte(lz)}
+
+		for i := 8 - lz - 1; i >= 0; i-- {
+			b = append(b, byte(uint64(x)>>(8*i)))
+		}
+
+		return b
+	case x < -(1 << 6):
+		x += 1<<13 + 1<<6
+		return []byte{0x20 | byte(x>>8)&0x1f, byte(x)}
+	case x < 0:
+		return []byte{0x40 | byte(x+1<<6)&0x3f}
+	}
+
+	return packUint(uint64(x))
+}
+
+func TestUnpackUint(t *testing.T) {
+	tests := []struct {
+		in   []byte
+		want uint64
+	}{
+		{in: []byte{0x80}, want: 0},
+		{in: []byte{0xbf}, want: 63},
+		{in: []byte{0xc0, 0x00}, want: 64},
+		{in: []byte{0xdf, 0xff}, want: 8255},
+		{in: []byte{0xe0}, want: 8256},
+		{in: []byte{0xe1, 0x01}, want: 8257},
+		{in: []byte{0xe3, 0x01, 0x00, 0x00}, want: 1<<16 + 8256},
+		{in: []byte{0xe8, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xdf, 0xbf}, want: math.MaxUint64},
+	}
+
+	for _, tt := range tests {
+		got, n, err := unpackUint(tt.in)
+		if err != nil || got != tt.want || n != len(tt.in) {
+			t.Errorf("unpackUint(% x) = %d, %d, %v, want %d, %d", tt.in, got, n, err, tt.want, len(tt.in))
+		}
+
+		if packed := packUint(tt.want); string(packed) != string(tt.in) {
+			t.Errorf("packUint(%d) = % x, want % x", tt.want, packed, tt.in)
+		}
+	}
+}
+
+func TestUnpackInt(t *testing.T) {
+	tests := []struct {
+		in   []byte
+		want int64
+	}{
+		{in: []byte{0x80}, want: 0},
+		{in: []byte{0x7f}, want: -1},
+		{in: []byte{0x40}, want: -64},
+		{in: []byte{0x3f, 0xff}, want: -65},
+		{in: []byte{0x20, 0x00}, want: -8256},
+		{in: []byte{0x16, 0xdf, 0xbf}, want: -8257},
+		{in: []byte{0x10, 0x80, 0, 0, 0, 0, 0, 0, 0}, want: math.MinInt64},
+		{in: []byte{0xe8, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xdf, 0xbf}, want: math.MaxInt64},
+	}
+
+	for _, tt := range tests {
+		got, n, err := unpackInt(tt.in)
+		if err != nil || got != tt.want || n != len(tt.in) {
+			t.Errorf("unpackInt(% x) = %d, %d, %v, want %d, %d", tt.in, got, n, err, tt.want, len(tt.in))
+		}
+
+		if packed := packInt(tt.want); string(packed) != string(tt.in) {
+			t.Errorf("packInt(%d) = % x, want % x", tt.want, packed, tt.in)
+		}
+	}
+}
+
+func TestUnpackRoundTrip(t *testing.T) {
+	ints := []int64{math.MinInt64, math.MaxInt64}
+	for _, edge := range []int64{0, 1 << 6, 1<<13 + 1<<6, 1 << 16, 1 << 32, 1 << 56} {
+		for d := int64(-2); d <= 2; d++ {
+			ints = append(ints, edge+d, -edge+d)
+		}
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		ints = append(ints, rng.Int63()>>rng.Intn(63), -(rng.Int63() >> rng.Intn(63)))
+	}
+
+	for _, x := range ints {
+		if got, _, err := unpackInt(packInt(x)); err != nil || got != x {
+			t.Errorf("int %d: got %d, %v", x, got, err)
+		}
+
+		if x < 0 {
+			continue
+		}
+
+		if got, _, err := unpackUint(packUint(uint64(x))); err != nil || got != uint64(x) {
+			t.Errorf("uint %d: got %d, %v", x, got, err)
+		}
+	}
+}
+
+func TestUnpackMalformed(t *testing.T) {
+	for _, in := range [][]byte{
+		nil,
+		{0xc0},
+		{0xe2, 0x01},
+		{0xe9, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		{0xf0},
+		{0x00},
+	} {
+		if x, _, err := unpackUint(in); err == nil {
+			t.Errorf("unpackUint(% x) = %d, want an error", in, x)
+		}
+	}
+
+	for _, in := range [][]byte{
+		nil,
+		{0x20},
+		{0x19},
+		{0x05, 0, 0, 0, 0, 0, 0, 0, 0},
+		{0x10, 0x80},
+		{0xc5},
+	} {
+		if x, _, err := unpackInt(in); err == nil {
+			t.Errorf("unpackInt(% x) = %d, want an error", in, x)
+		}
+	}
+}
+
+func TestUnpackFields(t *testing.T) {
+	tests := []struct {
+		format string
+		in     []byte
+		want   []any
+	}{
+		{format: "iSu", in: []byte{0x85, 'a', 'b', 0, 1, 2}, want: []any{int32(5), "ab", []byte{1, 2}}},
+		{format: "uQ", in: []byte{0x82, 1, 2, 0x80}, want: []any{[]byte{1, 2}, uint64(0)}},
+		{format: "U", in: []byte{0x81, 9}, want: []any{[]byte{9}}},
+		{format: "3s", in: []byte("abc"), want: []any{"abc"}},
+		{format: "5S", in: []byte("ab\x00\x00\x00"), want: []any{"ab"}},
+		{format: "2u", in: []byte{1, 2}, want: []any{[]byte{1, 2}}},
+		{format: "2i", in: []byte{0x81, 0x82}, want: []any{int32(1), int32(2)}},
+		{format: "bBh", in: []byte{0x7f, 0xff, 0x7f}, want: []any{int8(-1), uint8(255), int16(-1)}},
+		{format: "xq", in: []byte{0, 0x3f, 0xff}, want: []any{int64(-65)}},
+		{format: "rI", in: []byte{0xe1, 0x01, 0xbf}, want: []any{uint64(8257), uint32(63)}},
+		{format: ">L", in: []byte{0x80}, want: []any{uint32(0)}},
+	}
+
+	for _, tt := range tests {
+		got, err := unpackFields(tt.format, tt.in)
+		if err != nil {
+			t.Errorf("%s % x: %s", tt.format, tt.in, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s % x: got %#v, want %#v", tt.format, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestUnpackFieldsMalformed(t *testing.T) {
+	tests := []struct {
+		format string
+		in     []byte
+	}{
+		{format: "S", in: []byte("ab")},
+		{format: "i", in: []byte{0x80, 0x80}},
+		{format: "i", in: nil},
+		{format: "z", in: []byte{0}},
+		{format: "uQ", in: []byte{0x85, 1, 0x80}},
+		{format: "3s", in: []byte("ab")},
+		{format: "5S", in: []byte("ab")},
+		{format: "b", in: nil},
+		{format: "x", in: nil},
+	}
+
+	for _, tt := range tests {
+		if got, err := unpackFields(tt.format, tt.in); err == nil {
+			t.Errorf("%s % x: got %#v, want an error", tt.format, tt.in, got)
+		}
+	}
+}
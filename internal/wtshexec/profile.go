@@ -0,0 +1,92 @@
+package wtshexec
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"wtsh/internal/wtshmsg"
+)
+
+// profileStats are the statistics \profile reports the change in.
+var profileStats = []string{
+	"cache: pages requested from the cache",
+	"cache: pages read into cache",
+	"block-manager: bytes read",
+	"block-manager: bytes written",
+}
+
+// handle runs a command, reporting how long it took with \timing on and
+// what it cost in statistics with \profile on.
+func (r *ConnectionHandler) handle(s string) error {
+	if (!r.timing && !r.profile) || strings.HasPrefix(s, `\`) {
+		return r.dispatch(s)
+	}
+
+	var before map[string]int64
+
+	if r.profile && r.state.conn != nil {
+		stats, err := r.statistics(profileStats...)
+		if err != nil {
+			r.logger.Printf("profile: %s\n", err)
+		}
+
+		before = stats
+	}
+
+	start := time.Now()
+	err := r.dispatch(s)
+
+	m := wtshmsg.ProfileMessage{Elapsed: time.Since(start)}
+
+	// the command may have closed the connection
+	if before != nil && r.state.conn != nil {
+		after, serr := r.statistics(profileStats...)
+		if serr != nil {
+			r.logger.Printf("profile: %s\n", serr)
+		} else {
+			delta := func(name string) int64 {
+				return after[name] - before[name]
+			}
+
+			m.Profiled = true
+			m.PagesRequested = delta(profileStats[0])
+			m.CacheMisses = delta(profileStats[1])
+			m.BytesRead = delta(profileStats[2])
+			m.BytesWritten = delta(profileStats[3])
+		}
+	}
+
+	r.handler.HandleMessage(m)
+
+	return err
+}
+
+// profileCommand implements \timing and \profile [on | off], which toggle
+// without an argument.
+func (r *ConnectionHandler) profileCommand(cmd, args string) error {
+	setting := &r.timing
+	if cmd == `\profile` {
+		setting = &r.profile
+	}
+
+	switch args {
+	case "":
+		*setting = !*setting
+	case "on":
+		*setting = true
+	case "off":
+		*setting = false
+	default:
+		return fmt.Errorf(`parse: %s [on | off]`, cmd)
+	}
+
+	// find out now rather than on every command
+	if cmd == `\profile` && r.profile && r.state.conn != nil {
+		if _, err := r.statistics(); err != nil {
+			r.profile = false
+			return fmt.Errorf("profile: %w, open with statistics=(fast) to enable", err)
+		}
+	}
+
+	return nil
+}
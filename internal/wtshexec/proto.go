@@ -0,0 +1,78 @@
+package wtshexec
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// protoDecoder reads messages of one type from a descriptor set, as written
+// by protoc --descriptor_set_out --include_imports.
+type protoDecoder struct {
+	message protoreflect.MessageDescriptor
+}
+
+func newProtoDecoder(args []string) (decoder, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("expected <descriptor set> <message name>")
+	}
+
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("read descriptor set: %w", err)
+	}
+
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parse descriptor set: %w", err)
+	}
+
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("descriptor set: %w", err)
+	}
+
+	d, err := files.FindDescriptorByName(protoreflect.FullName(args[1]))
+	if err != nil {
+		return nil, fmt.Errorf("find '%s': %w", args[1], err)
+	}
+
+	message, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("'%s' is not a message", args[1])
+	}
+
+	return protoDecoder{message: message}, nil
+}
+
+func (p protoDecoder) decode(b []byte) (any, error) {
+	m := dynamicpb.NewMessage(p.message)
+
+	if err := proto.Unmarshal(b, m); err != nil {
+		return nil, err
+	}
+
+	data, err := protojson.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.RawMessage(data), nil
+}
+
+func (p protoDecoder) encode(data []byte) ([]byte, error) {
+	m := dynamicpb.NewMessage(p.message)
+
+	if err := protojson.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+
+	return proto.Marshal(m)
+}
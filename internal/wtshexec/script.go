@@ -0,0 +1,381 @@
+package wtshexec
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"wtsh/internal/wtshmsg"
+)
+
+type commandStatement struct {
+	line    int
+	command string
+}
+
+type forStatement struct {
+	line   int
+	name   string
+	source string
+	body   []any
+}
+
+type ifStatement struct {
+	line      int
+	condition string
+	then      []any
+	otherwise []any
+}
+
+type assertStatement struct {
+	line int
+	expr string
+}
+
+type scriptError struct {
+	line int
+	err  error
+}
+
+func (e *scriptError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.line, e.err)
+}
+
+func (e *scriptError) Unwrap() error {
+	return e.err
+}
+
+type piece struct {
+	line int
+	text string
+}
+
+func isBlockHeader(s string) bool {
+	for _, kw := range []string{"for ", "if ", "else"} {
+		if strings.HasPrefix(s, kw) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitPieces breaks a script into statements. Outside of for/if blocks
+// each line is one command, taken as is. Inside a block, and on a line that
+// starts one, statements are also split at ';' and quotes may span lines.
+// Braces only open a block after for/if/else, and a '}' only closes one if
+// it has no matching '{' earlier in the statement, so '${name}' and JSON
+// values are left alone.
+func splitPieces(src string, firstLine int) []piece {
+	pieces := make([]piece, 0, 16)
+
+	var b strings.Builder
+	line := firstLine
+	start := line
+	var quote byte
+	depth := 0
+	blocks := 0
+
+	flush := func() {
+		text := strings.TrimSpace(b.String())
+		if text != "" && !strings.HasPrefix(text, "#") {
+			pieces = append(pieces, piece{line: start, text: text})
+		}
+
+		b.Reset()
+		start = line
+		depth = 0
+	}
+
+	// structured reports whether the line starting at i is part of a block
+	structured := func(i int) bool {
+		text := src[i:]
+		if end := strings.IndexByte(text, '\n'); end >= 0 {
+			text = text[:end]
+		}
+
+		text = strings.TrimSpace(text)
+
+		return blocks > 0 || isBlockHeader(text) || strings.HasPrefix(text, "}")
+	}
+
+	block := structured(0)
+
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+
+		if quote != 0 {
+			b.WriteByte(c)
+
+			switch {
+			case c == '\\' && i+1 < len(src):
+				i++
+				b.WriteByte(src[i])
+			case c == quote:
+				quote = 0
+			case c == '\n':
+				line++
+			}
+
+			continue
+		}
+
+		switch {
+		case c == '\n':
+			flush()
+			line++
+			start = line
+			block = structured(i + 1)
+		case c == '#' && strings.TrimSpace(b.String()) == "":
+			for i+1 < len(src) && src[i+1] != '\n' {
+				i++
+			}
+		case !block:
+			b.WriteByte(c)
+		case c == ';':
+			flush()
+		case c == '}' && depth == 0:
+			flush()
+			b.WriteByte(c)
+			flush()
+
+			blocks = max(blocks-1, 0)
+		case c == '}':
+			depth--
+			b.WriteByte(c)
+		case c == '{' && (i == 0 || src[i-1] != '$') && isBlockHeader(strings.TrimSpace(b.String())):
+			b.WriteByte(c)
+			flush()
+
+			blocks++
+		case c == '{':
+			depth++
+			b.WriteByte(c)
+		case c == '"' || c == '\'':
+			quote = c
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	flush()
+
+	return pieces
+}
+
+func parseScript(src string, firstLine int) ([]any, error) {
+	pieces := splitPieces(src, firstLine)
+
+	i := 0
+
+	statements, err := parseBlock(pieces, &i, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	return statements, nil
+}
+
+func blockHeader(p piece, keyword string) (string, error) {
+	if !strings.HasSuffix(p.text, "{") {
+		return "", &scriptError{line: p.line, err: fmt.Errorf("expected '{' at end of '%s'", p.text)}
+	}
+
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(p.text, keyword), "{")), nil
+}
+
+// parseBlock parses statements until the closing brace of the block opened on
+// line open, or until the end of input for the top level (open == -1).
+func parseBlock(pieces []piece, i *int, open int) ([]any, error) {
+	statements := make([]any, 0, 4)
+
+	for *i < len(pieces) {
+		p := pieces[*i]
+		*i++
+
+		switch {
+		case p.text == "}":
+			if open == -1 {
+				return nil, &scriptError{line: p.line, err: fmt.Errorf("unexpected '}'")}
+			}
+
+			return statements, nil
+		case strings.HasPrefix(p.text, "for "):
+			header, err := blockHeader(p, "for ")
+			if err != nil {
+				return nil, err
+			}
+
+			name, source, ok := strings.Cut(header, " in ")
+			if !ok || !validName(strings.TrimSpace(name)) {
+				return nil, &scriptError{line: p.line, err: fmt.Errorf("parse: for <name> in <command> {")}
+			}
+
+			body, err := parseBlock(pieces, i, p.line)
+			if err != nil {
+				return nil, err
+			}
+
+			statements = append(statements, forStatement{
+				line:   p.line,
+				name:   strings.TrimSpace(name),
+				source: strings.TrimSpace(source),
+				body:   body,
+			})
+		case strings.HasPrefix(p.text, "if "):
+			st, err := parseIf(pieces, i, p)
+			if err != nil {
+				return nil, err
+			}
+
+			statements = append(statements, st)
+		case strings.HasPrefix(p.text, "else"):
+			return nil, &scriptError{line: p.line, err: fmt.Errorf("'else' without 'if'")}
+		case strings.HasPrefix(p.text, "assert "):
+			statements = append(statements, assertStatement{
+				line: p.line,
+				expr: strings.TrimSpace(strings.TrimPrefix(p.text, "assert ")),
+			})
+		default:
+			statements = append(statements, commandStatement{line: p.line, command: p.text})
+		}
+	}
+
+	if open != -1 {
+		return nil, &scriptError{line: open, err: fmt.Errorf("missing '}'")}
+	}
+
+	return statements, nil
+}
+
+func parseIf(pieces []piece, i *int, p piece) (ifStatement, error) {
+	condition, err := blockHeader(p, "if ")
+	if err != nil {
+		return ifStatement{}, err
+	}
+
+	then, err := parseBlock(pieces, i, p.line)
+	if err != nil {
+		return ifStatement{}, err
+	}
+
+	st := ifStatement{
+		line:      p.line,
+		condition: condition,
+		then:      then,
+	}
+
+	if *i >= len(pieces) || !strings.HasPrefix(pieces[*i].text, "else") {
+		return st, nil
+	}
+
+	e := pieces[*i]
+	*i++
+
+	rest := strings.TrimSpace(strings.TrimPrefix(e.text, "else"))
+
+	if strings.HasPrefix(rest, "if ") {
+		nested, err := parseIf(pieces, i, piece{line: e.line, text: rest})
+		if err != nil {
+			return ifStatement{}, err
+		}
+
+		st.otherwise = []any{nested}
+
+		return st, nil
+	}
+
+	if rest != "{" {
+		return ifStatement{}, &scriptError{line: e.line, err: fmt.Errorf("expected '{' after 'else'")}
+	}
+
+	otherwise, err := parseBlock(pieces, i, e.line)
+	if err != nil {
+		return ifStatement{}, err
+	}
+
+	st.otherwise = otherwise
+
+	return st, nil
+}
+
+func (r *ConnectionHandler) runScript(statements []any) error {
+	for _, st := range statements {
+		line, err := r.runStatement(st)
+		if err == nil {
+			continue
+		}
+
+		var serr *scriptError
+		if errors.As(err, &serr) {
+			return err
+		}
+
+		return &scriptError{line: line, err: err}
+	}
+
+	return nil
+}
+
+func (r *ConnectionHandler) runStatement(st any) (int, error) {
+	switch v := st.(type) {
+	case commandStatement:
+		if len(r.sources) > 0 {
+			r.handler.HandleMessage(wtshmsg.ScriptCommandMessage{
+				Path:    r.sources[len(r.sources)-1],
+				Line:    v.line,
+				Command: v.command,
+			})
+		}
+
+		return v.line, r.handle(v.command)
+	case forStatement:
+		source, err := r.expand(v.source)
+		if err != nil {
+			return v.line, err
+		}
+
+		records, err := r.collect(source)
+		if err != nil {
+			return v.line, err
+		}
+
+		for _, rec := range records {
+			r.vars[v.name] = rec
+
+			if err := r.runScript(v.body); err != nil {
+				return v.line, err
+			}
+		}
+
+		return v.line, nil
+	case ifStatement:
+		c, err := r.eval(v.condition)
+		if err != nil {
+			return v.line, fmt.Errorf("if: %w", err)
+		}
+
+		if truthy(c) {
+			return v.line, r.runScript(v.then)
+		}
+
+		return v.line, r.runScript(v.otherwise)
+	case assertStatement:
+		c, err := r.eval(v.expr)
+		if err != nil {
+			return v.line, fmt.Errorf("assert: %w", err)
+		}
+
+		if truthy(c) {
+			return v.line, nil
+		}
+
+		if expanded, err := r.expand(v.expr); err == nil && expanded != v.expr {
+			return v.line, fmt.Errorf("assertion failed: %s (%s)", v.expr, expanded)
+		}
+
+		return v.line, fmt.Errorf("assertion failed: %s", v.expr)
+	}
+
+	return 0, fmt.Errorf("unknown statement %T", st)
+}
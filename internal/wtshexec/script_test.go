@@ -0,0 +1,229 @@
+package wtshexec
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitPieces(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		first int
+		want  []piece
+	}{
+		{
+			name: "one command per line",
+			src:  "set a = 1\n\n  set b = 2  \n",
+			want: []piece{{line: 1, text: "set a = 1"}, {line: 3, text: "set b = 2"}},
+		},
+		{
+			name: "comments",
+			src:  "# heading\nset a = 1\n  # indented",
+			want: []piece{{line: 2, text: "set a = 1"}},
+		},
+		{
+			name: "top level lines are taken as is",
+			src:  `insert k {"a": "}"}; echo 'x` + "\nset b = ${a}",
+			want: []piece{{line: 1, text: `insert k {"a": "}"}; echo 'x`}, {line: 2, text: "set b = ${a}"}},
+		},
+		{
+			name: "block",
+			src:  "if $x == 1 {\n  set y = ${x}; set z = 2\n}",
+			want: []piece{
+				{line: 1, text: "if $x == 1 {"},
+				{line: 2, text: "set y = ${x}"},
+				{line: 2, text: "set z = 2"},
+				{line: 3, text: "}"},
+			},
+		},
+		{
+			name: "block on one line",
+			src:  "for r in scan t { set x = ${r.key}; }",
+			want: []piece{
+				{line: 1, text: "for r in scan t {"},
+				{line: 1, text: "set x = ${r.key}"},
+				{line: 1, text: "}"},
+			},
+		},
+		{
+			name: "braces and quotes inside a block",
+			src:  "if true {\n  insert k {\"a\": \"};{\"}\n  set s = 'a;\nb'\n}",
+			want: []piece{
+				{line: 1, text: "if true {"},
+				{line: 2, text: `insert k {"a": "};{"}`},
+				{line: 3, text: "set s = 'a;\nb'"},
+				{line: 5, text: "}"},
+			},
+		},
+		{
+			name: "else",
+			src:  "if true {\n} else {\n}",
+			want: []piece{
+				{line: 1, text: "if true {"},
+				{line: 2, text: "}"},
+				{line: 2, text: "else {"},
+				{line: 3, text: "}"},
+			},
+		},
+		{
+			name: "after a block",
+			src:  "if true {\n}\nset a = {\"b\": 1}; x",
+			want: []piece{
+				{line: 1, text: "if true {"},
+				{line: 2, text: "}"},
+				{line: 3, text: `set a = {"b": 1}; x`},
+			},
+		},
+		{
+			name:  "first line number",
+			src:   "a\nb",
+			first: 10,
+			want:  []piece{{line: 10, text: "a"}, {line: 11, text: "b"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := max(tt.first, 1)
+
+			if got := splitPieces(tt.src, first); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseScript(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []any
+	}{
+		{
+			name: "commands and assert",
+			src:  "set a = 1\nassert $a == 1",
+			want: []any{
+				commandStatement{line: 1, command: "set a = 1"},
+				assertStatement{line: 2, expr: "$a == 1"},
+			},
+		},
+		{
+			name: "for",
+			src:  "for r in scan t {\n  assert ${r.key} > 0\n}",
+			want: []any{
+				forStatement{line: 1, name: "r", source: "scan t", body: []any{
+					assertStatement{line: 2, expr: "${r.key} > 0"},
+				}},
+			},
+		},
+		{
+			name: "else if chain",
+			src:  "if $x == 1 {\n  set r = one\n} else if $x == 2 {\n  set r = two\n} else {\n  set r = other\n}",
+			want: []any{
+				ifStatement{
+					line:      1,
+					condition: "$x == 1",
+					then:      []any{commandStatement{line: 2, command: "set r = one"}},
+					otherwise: []any{ifStatement{
+						line:      3,
+						condition: "$x == 2",
+						then:      []any{commandStatement{line: 4, command: "set r = two"}},
+						otherwise: []any{commandStatement{line: 6, command: "set r = other"}},
+					}},
+				},
+			},
+		},
+		{
+			name: "nested",
+			src:  "if a {\n  if b {\n    c\n  }\n  d\n}\ne",
+			want: []any{
+				ifStatement{line: 1, condition: "a", then: []any{
+					ifStatement{line: 2, condition: "b", then: []any{commandStatement{line: 3, command: "c"}}},
+					commandStatement{line: 5, command: "d"},
+				}},
+				commandStatement{line: 7, command: "e"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseScript(tt.src, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseScriptInvalid(t *testing.T) {
+	tests := []struct {
+		src  string
+		line int
+	}{
+		{src: "a\n}", line: 2},
+		{src: "if true {\n  a", line: 1},
+		{src: "a\nelse {\n}", line: 2},
+		{src: "if true\n", line: 1},
+		{src: "for x scan t {\n}", line: 1},
+		{src: "for 1x in scan t {\n}", line: 1},
+		{src: "if true {\n} else nope", line: 2},
+		{src: "if true {\n} else if false {\n", line: 2},
+	}
+
+	for _, tt := range tests {
+		_, err := parseScript(tt.src, 1)
+
+		serr, ok := err.(*scriptError)
+		if !ok {
+			t.Errorf("%q: got %v, want a script error", tt.src, err)
+			continue
+		}
+
+		if serr.line != tt.line {
+			t.Errorf("%q: error on line %d, want %d: %s", tt.src, serr.line, tt.line, err)
+		}
+	}
+}
+
+func TestRunScriptElseIf(t *testing.T) {
+	statements, err := parseScript("if $x == 1 {\n  set r = one\n} else if $x == 2 {\n  set r = two\n} else {\n  set r = other\n}", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for x, want := range map[string]string{"1": "one", "2": "two", "3": "other"} {
+		r := newTestHandler(map[string]any{"x": x})
+
+		if err := r.runScript(statements); err != nil {
+			t.Fatalf("x = %s: %s", x, err)
+		}
+
+		if got := r.vars["r"]; got != want {
+			t.Errorf("x = %s: r = %v, want %s", x, got, want)
+		}
+	}
+}
+
+func TestRunScriptAssert(t *testing.T) {
+	statements, err := parseScript("set a = 1\nassert $a == 1\nassert $a + 1 == 3", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = newTestHandler(nil).runScript(statements)
+
+	serr, ok := err.(*scriptError)
+	if !ok {
+		t.Fatalf("got %v, want a script error", err)
+	}
+
+	if want := "line 3: assertion failed: $a + 1 == 3 (1 + 1 == 3)"; serr.Error() != want {
+		t.Errorf("got %q, want %q", serr.Error(), want)
+	}
+}
@@ -0,0 +1,205 @@
+package wtshexec
+
+import (
+	"fmt"
+	"time"
+	"wtsh/internal/wtshmsg"
+)
+
+// run handles a command from the shell, following it with the state for
+// the status bar.
+func (r *ConnectionHandler) run(s string) error {
+	start := time.Now()
+	err := r.handle(s)
+
+	r.handler.HandleMessage(r.status(time.Since(start)))
+
+	return err
+}
+
+func (r *ConnectionHandler) status(elapsed time.Duration) wtshmsg.StatusMessage {
+	m := wtshmsg.StatusMessage{
+		Home:        r.state.home,
+		Session:     r.state.session != nil,
+		Transaction: r.state.transaction,
+		Elapsed:     elapsed,
+	}
+
+	if m.Session {
+		m.Isolation = "snapshot"
+
+		if isolation, ok := configValue(r.state.sessionConfig, "isolation"); ok {
+			m.Isolation = isolation
+		}
+	}
+
+	if r.state.cursor != nil {
+		m.Cursor = r.state.schema.uri
+		m.KeyFormat = string(r.state.schema.keyFormat)
+		m.ValueFormat = string(r.state.schema.valueFormat)
+	}
+
+	if r.state.conn != nil && !r.state.noStats {
+		used, limit, err := r.cacheUsage()
+		if err != nil {
+			// don't try again until the next connection
+			r.logger.Printf("cache usage: %s\n", err)
+			r.state.noStats = true
+		}
+
+		m.CacheUsed, m.CacheMax = used, limit
+	}
+
+	return m
+}
+
+// cacheUsage reads the cache size from the connection statistics.
+func (r *ConnectionHandler) cacheUsage() (int64, int64, error) {
+	const used, limit = "cache: bytes currently in the cache", "cache: maximum bytes configured"
+
+	stats, err := r.statistics(used, limit)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return stats[used], stats[limit], nil
+}
+
+// statistics reads the named connection statistics by description, which
+// fails unless the connection was opened with statistics enabled. The first
+// call scans every statistic to learn their keys; after that only the named
+// ones are searched for, since this runs after every command.
+func (r *ConnectionHandler) statistics(names ...string) (map[string]int64, error) {
+	if r.state.stats == nil {
+		session, err := r.state.conn.OpenSession("")
+		if err != nil {
+			return nil, fmt.Errorf("open session: %w", err)
+		}
+
+		r.state.stats = session
+	}
+
+	cursor, err := r.state.stats.OpenCursor("statistics:", "")
+	if err != nil {
+		return nil, fmt.Errorf("open statistics cursor: %w", err)
+	}
+	defer cursor.Close()
+
+	stats := make(map[string]int64, len(names))
+
+	if r.state.statKeys == nil {
+		keys := make(map[string][]any)
+
+		for cursor.Next() {
+			rec, err := r.readRecord(cursor)
+			if err != nil {
+				return nil, err
+			}
+
+			name, v, ok := statistic(rec)
+			if !ok {
+				continue
+			}
+
+			keys[name] = rec.Key
+			stats[name] = v
+		}
+
+		if err := cursor.Err(); err != nil {
+			return nil, err
+		}
+
+		r.state.statKeys = keys
+
+		return stats, nil
+	}
+
+	for _, name := range names {
+		key, ok := r.state.statKeys[name]
+		if !ok {
+			continue
+		}
+
+		// wtgo appends to the key it was given last until the cursor is reset
+		if err := cursor.Reset(); err != nil {
+			return nil, fmt.Errorf("reset: %w", err)
+		}
+
+		if err := cursor.SetKey(key...); err != nil {
+			return nil, fmt.Errorf("set key: %w", err)
+		}
+
+		if err := cursor.Search(); err != nil {
+			return nil, fmt.Errorf("search '%s': %w", name, err)
+		}
+
+		rec, err := r.readRecord(cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, v, ok := statistic(rec); ok {
+			stats[name] = v
+		}
+	}
+
+	return stats, nil
+}
+
+// statistic splits a statistics cursor record, whose values are the
+// description, the printable value and the value.
+func statistic(rec record) (string, int64, bool) {
+	if len(rec.Value) != 3 {
+		return "", 0, false
+	}
+
+	n, _ := number(rec.Value[2])
+	v, _ := n.(int64)
+
+	return formatValue(rec.Value[0]), v, true
+}
+
+// transaction implements begin-, commit- and rollback-transaction [config].
+func (r *ConnectionHandler) transaction(cmd, config string) error {
+	switch cmd {
+	case "begin-transaction":
+		if r.state.transaction {
+			return fmt.Errorf("transaction already running")
+		}
+
+		if err := r.state.session.BeginTransaction(config); err != nil {
+			return fmt.Errorf("begin transaction: %w", err)
+		}
+
+		r.state.transaction = true
+
+		r.handler.HandleMessage(wtshmsg.TransactionMessage{State: "started"})
+	case "commit-transaction":
+		if !r.state.transaction {
+			return fmt.Errorf("no running transaction")
+		}
+
+		// the transaction is over even if the commit failed
+		r.state.transaction = false
+
+		if err := r.state.session.CommitTransaction(config); err != nil {
+			return fmt.Errorf("commit transaction: %w", err)
+		}
+
+		r.handler.HandleMessage(wtshmsg.TransactionMessage{State: "committed"})
+	case "rollback-transaction":
+		if !r.state.transaction {
+			return fmt.Errorf("no running transaction")
+		}
+
+		r.state.transaction = false
+
+		if err := r.state.session.RollbackTransaction(config); err != nil {
+			return fmt.Errorf("rollback transaction: %w", err)
+		}
+
+		r.handler.HandleMessage(wtshmsg.TransactionMessage{State: "rolled back"})
+	}
+
+	return nil
+}
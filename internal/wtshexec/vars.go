@@ -0,0 +1,322 @@
+package wtshexec
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type record struct {
+	Key   []any
+	Value []any
+}
+
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case []any:
+		s := make([]string, 0, len(v))
+		for _, e := range v {
+			s = append(s, formatValue(e))
+		}
+
+		return strings.Join(s, ",")
+	case record:
+		return formatValue(v.Key) + " " + formatValue(v.Value)
+	case []record:
+		s := make([]string, 0, len(v))
+		for _, e := range v {
+			s = append(s, formatValue(e))
+		}
+
+		return strings.Join(s, "\n")
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func isNameByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func validName(name string) bool {
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		return false
+	}
+
+	for i := 0; i < len(name); i++ {
+		if !isNameByte(name[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// expand replaces $name, ${name} and $$ in s. Names may be followed by
+// .key/.value field selectors and [n] indexes, e.g. $k.value[0].
+func (r *ConnectionHandler) expand(s string) (string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		if i+1 < len(s) && s[i+1] == '$' {
+			b.WriteByte('$')
+			i++
+			continue
+		}
+
+		var ref string
+
+		if i+1 < len(s) && s[i+1] == '{' {
+			end := strings.IndexByte(s[i:], '}')
+			if end == -1 {
+				return "", fmt.Errorf("unterminated '${' in '%s'", s)
+			}
+
+			ref = s[i+2 : i+end]
+			i += end
+		} else {
+			j := scanReference(s, i+1)
+			ref = s[i+1 : j]
+			i = j - 1
+		}
+
+		if ref == "" {
+			b.WriteByte('$')
+			continue
+		}
+
+		v, err := r.lookup(ref)
+		if err != nil {
+			return "", err
+		}
+
+		b.WriteString(formatValue(v))
+	}
+
+	return b.String(), nil
+}
+
+func scanReference(s string, i int) int {
+	for i < len(s) && isNameByte(s[i]) {
+		i++
+	}
+
+	for i < len(s) {
+		switch {
+		case s[i] == '.' && i+1 < len(s) && isNameByte(s[i+1]):
+			i++
+			for i < len(s) && isNameByte(s[i]) {
+				i++
+			}
+		case s[i] == '[':
+			end := strings.IndexByte(s[i:], ']')
+			if end == -1 {
+				return i
+			}
+
+			i += end + 1
+		default:
+			return i
+		}
+	}
+
+	return i
+}
+
+func (r *ConnectionHandler) lookup(ref string) (any, error) {
+	end := strings.IndexAny(ref, ".[")
+	if end == -1 {
+		end = len(ref)
+	}
+
+	name := ref[:end]
+
+	v, ok := r.vars[name]
+	if !ok {
+		return nil, fmt.Errorf("'%s' is not defined", name)
+	}
+
+	return selectPath(v, ref[end:])
+}
+
+func selectPath(v any, path string) (any, error) {
+	for path != "" {
+		switch path[0] {
+		case '.':
+			end := strings.IndexAny(path[1:], ".[")
+			if end == -1 {
+				end = len(path) - 1
+			}
+
+			field := path[1 : end+1]
+			path = path[end+1:]
+
+			rec, ok := v.(record)
+			if !ok {
+				rows, ok := v.([]record)
+				if !ok || len(rows) == 0 {
+					return nil, fmt.Errorf("no field '%s' on %s", field, describeValue(v))
+				}
+
+				rec = rows[0]
+			}
+
+			switch field {
+			case "key":
+				v = unwrap(rec.Key)
+			case "value":
+				v = unwrap(rec.Value)
+			default:
+				return nil, fmt.Errorf("no field '%s' on record", field)
+			}
+		case '[':
+			end := strings.IndexByte(path, ']')
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated '[' in '%s'", path)
+			}
+
+			n, err := strconv.Atoi(strings.TrimSpace(path[1:end]))
+			if err != nil {
+				return nil, fmt.Errorf("index: %w", err)
+			}
+
+			path = path[end+1:]
+
+			e, err := index(v, n)
+			if err != nil {
+				return nil, err
+			}
+
+			v = e
+		default:
+			return nil, fmt.Errorf("unexpected '%c' in '%s'", path[0], path)
+		}
+	}
+
+	return v, nil
+}
+
+func index(v any, n int) (any, error) {
+	var l int
+
+	switch v := v.(type) {
+	case []any:
+		l = len(v)
+		if n >= 0 && n < l {
+			return v[n], nil
+		}
+	case []record:
+		l = len(v)
+		if n >= 0 && n < l {
+			return v[n], nil
+		}
+	default:
+		// single column keys and values are unwrapped, so allow [0]
+		if n == 0 {
+			return v, nil
+		}
+
+		return nil, fmt.Errorf("cannot index %s", describeValue(v))
+	}
+
+	return nil, fmt.Errorf("index %d out of range [0:%d]", n, l)
+}
+
+func unwrap(fields []any) any {
+	if len(fields) == 1 {
+		return fields[0]
+	}
+
+	return fields
+}
+
+func describeValue(v any) string {
+	switch v := v.(type) {
+	case record:
+		return "record"
+	case []record:
+		return fmt.Sprintf("%d rows", len(v))
+	case []any:
+		return fmt.Sprintf("%d fields", len(v))
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func (r *ConnectionHandler) set(args string) error {
+	name, value, ok := strings.Cut(args, "=")
+	if !ok {
+		return fmt.Errorf("parse: set <name> = <value>")
+	}
+
+	name = strings.TrimSpace(name)
+
+	if !validName(name) {
+		return fmt.Errorf("'%s' is not a valid variable name", name)
+	}
+
+	r.vars[name] = strings.TrimSpace(value)
+
+	return nil
+}
+
+func (r *ConnectionHandler) let(args string) error {
+	name, cmd, ok := strings.Cut(args, "=")
+	if !ok {
+		return fmt.Errorf("parse: let <name> = <command>")
+	}
+
+	name = strings.TrimSpace(name)
+
+	if !validName(name) {
+		return fmt.Errorf("'%s' is not a valid variable name", name)
+	}
+
+	cmd = strings.TrimSpace(cmd)
+
+	captured, err := r.collect(cmd)
+	if err != nil {
+		return err
+	}
+
+	switch len(captured) {
+	case 0:
+		return fmt.Errorf("'%s' returned no rows", cmd)
+	case 1:
+		r.vars[name] = captured[0]
+	default:
+		r.vars[name] = captured
+	}
+
+	return nil
+}
+
+func (r *ConnectionHandler) collect(cmd string) ([]record, error) {
+	captured := make([]record, 0, 1)
+
+	previous := r.capture
+	r.capture = &captured
+	err := r.exec(cmd)
+	r.capture = previous
+
+	if err != nil {
+		return nil, err
+	}
+
+	return captured, nil
+}
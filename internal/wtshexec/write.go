@@ -0,0 +1,165 @@
+package wtshexec
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dylrich/wtgo"
+)
+
+// update implements update <keys> <values>, which fails if the key doesn't
+// exist, and upsert <keys> <values>, which writes it either way. Unlike
+// insert, neither depends on how the cursor's overwrite is configured.
+func (r *ConnectionHandler) update(cmd, args string) error {
+	parts := strings.SplitN(args, " ", 2)
+
+	if len(parts) < 2 {
+		return fmt.Errorf("parse: %s <keys> <values>", cmd)
+	}
+
+	keysa, err := r.keyArgs(parts[0])
+	if err != nil {
+		return fmt.Errorf("key: %w", err)
+	}
+
+	valuesa, err := r.valueArgs(parts[1])
+	if err != nil {
+		return fmt.Errorf("value: %w", err)
+	}
+
+	found, err := r.seek(keysa)
+	if err != nil {
+		return err
+	}
+
+	if !found && cmd == "update" {
+		return fmt.Errorf("update: key not found")
+	}
+
+	if err := r.state.cursor.SetValue(valuesa...); err != nil {
+		return fmt.Errorf("set value: %w", err)
+	}
+
+	if found {
+		if err := r.state.cursor.Update(); err != nil {
+			return fmt.Errorf("%s: %w", cmd, err)
+		}
+
+		return nil
+	}
+
+	if err := r.state.cursor.Insert(); err != nil {
+		return fmt.Errorf("%s: %w", cmd, err)
+	}
+
+	return nil
+}
+
+// modify implements modify <keys> <offset> <size> <data>, replacing size
+// bytes of the value at offset with data, which may be longer, shorter or
+// empty. WiredTiger only allows it on 'u' and 'S' values, in a transaction.
+func (r *ConnectionHandler) modify(args string) error {
+	parts := strings.SplitN(args, " ", 4)
+
+	if len(parts) < 3 {
+		return fmt.Errorf("parse: modify <keys> <offset> <size> <data>")
+	}
+
+	keysa, err := r.keyArgs(parts[0])
+	if err != nil {
+		return fmt.Errorf("key: %w", err)
+	}
+
+	offset, err := strconv.ParseUint(parts[1], 0, 64)
+	if err != nil {
+		return fmt.Errorf("parse: offset: %w", err)
+	}
+
+	size, err := strconv.ParseUint(parts[2], 0, 64)
+	if err != nil {
+		return fmt.Errorf("parse: size: %w", err)
+	}
+
+	var data string
+	if len(parts) == 4 {
+		data = parts[3]
+	}
+
+	found, err := r.seek(keysa)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return fmt.Errorf("modify: key not found")
+	}
+
+	m := wtgo.Modification{Data: []byte(data), Offset: offset, Size: size}
+
+	if err := r.state.cursor.Modify([]wtgo.Modification{m}); err != nil {
+		return fmt.Errorf("modify: %w", err)
+	}
+
+	return r.resetCursor()
+}
+
+// reserve implements reserve <keys>, locking the record for the rest of the
+// running transaction without changing it.
+func (r *ConnectionHandler) reserve(args string) error {
+	if !r.state.transaction {
+		return fmt.Errorf("reserve: no running transaction")
+	}
+
+	keysa, err := r.keyArgs(args)
+	if err != nil {
+		return fmt.Errorf("key: %w", err)
+	}
+
+	found, err := r.seek(keysa)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return fmt.Errorf("reserve: key not found")
+	}
+
+	if err := r.state.cursor.Reserve(); err != nil {
+		return fmt.Errorf("reserve: %w", err)
+	}
+
+	return r.resetCursor()
+}
+
+// seek positions the cursor on keys. wtgo appends to the key it was given
+// last until the cursor is reset, so this starts from a reset cursor.
+func (r *ConnectionHandler) seek(keys []any) (bool, error) {
+	if err := r.resetCursor(); err != nil {
+		return false, err
+	}
+
+	if err := r.state.cursor.SetKey(keys...); err != nil {
+		return false, fmt.Errorf("set key: %w", err)
+	}
+
+	err := r.state.cursor.Search()
+
+	switch {
+	case errors.Is(err, wtgo.ErrNotFound):
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("search: %w", err)
+	}
+
+	return true, nil
+}
+
+func (r *ConnectionHandler) resetCursor() error {
+	if err := r.state.cursor.Reset(); err != nil {
+		return fmt.Errorf("reset: %w", err)
+	}
+
+	return nil
+}
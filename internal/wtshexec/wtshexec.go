@@ -2,9 +2,15 @@ package wtshexec
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 	"wtsh/internal/wtshmsg"
 
 	"github.com/dylrich/wtgo"
@@ -21,28 +27,98 @@ func New(cmdch <-chan string, logger *log.Logger, handler MessageHandler, cancel
 		handler: handler,
 		logger:  logger,
 		cancel:  cancel,
+		vars:    make(map[string]any),
 	}
 }
 
 type ConnectionHandler struct {
-	actions chan func()
-	cmdch   <-chan string
-	handler MessageHandler
-	cancel  context.CancelFunc
-	logger  *log.Logger
-	state   state
+	actions  chan func()
+	cmdch    <-chan string
+	handler  MessageHandler
+	cancel   context.CancelFunc
+	logger   *log.Logger
+	state    state
+	sources  []string
+	vars     map[string]any
+	capture  *[]record
+	readOnly bool
+	display  display
+	decoders map[string]map[string]columnDecoder
+	timing   bool
+	profile  bool
+	// done is closed when Run is stopped, and nil without Run
+	done <-chan struct{}
+	// transient is set while Do runs a command, whose handler must not be
+	// reported to once the command is done
+	transient bool
+}
+
+// ErrQuit is returned by quit, wherever it is run from, after calling the
+// cancel given to New. Callers sharing the handler, such as a server, use it
+// to end only their own use of it.
+var ErrQuit = errors.New("quit")
+
+var mutating = map[string]bool{
+	"insert":          true,
+	"remove":          true,
+	"set-value":       true,
+	"update":          true,
+	"upsert":          true,
+	"modify":          true,
+	"generate":        true,
+	"reserve":         true,
+	"create":          true,
+	"create-index":    true,
+	"create-colgroup": true,
+	"drop":            true,
 }
 
 type state struct {
-	conn    *wtgo.Connection
-	home    string
-	session *wtgo.Session
-	cursor  *wtgo.Cursor
+	conn          *wtgo.Connection
+	home          string
+	session       *wtgo.Session
+	sessionConfig string
+	transaction   bool
+	cursor        *wtgo.Cursor
+	schema        schema
+	browser       *browser
+	follow        *logFollow
+	// stats is a session of our own for reading statistics, so they don't
+	// disturb the user's transaction
+	stats   *wtgo.Session
+	noStats bool
+	// statKeys maps statistic descriptions to their statistics cursor keys
+	statKeys map[string][]any
 }
 
-func (r *ConnectionHandler) handle(s string) error {
+func (r *ConnectionHandler) dispatch(s string) error {
 	r.logger.Printf("running command '%s'\n", s)
 
+	// a multi-line paste runs like a sourced file
+	if strings.Contains(s, "\n") {
+		statements, err := parseScript(s, 1)
+		if err != nil {
+			return sourceError("<paste>", err)
+		}
+
+		return sourceError("<paste>", r.runScript(statements))
+	}
+
+	// control flow expands variables itself as each statement runs
+	switch cmd, _, _ := strings.Cut(s, " "); cmd {
+	case "for", "if", "assert":
+		return r.exec(s)
+	}
+
+	s, err := r.expand(s)
+	if err != nil {
+		return err
+	}
+
+	return r.exec(s)
+}
+
+func (r *ConnectionHandler) exec(s string) error {
 	parts := strings.SplitN(s, " ", 2)
 	cmd := parts[0]
 
@@ -51,6 +127,10 @@ func (r *ConnectionHandler) handle(s string) error {
 		args = parts[1]
 	}
 
+	if r.readOnly && mutating[cmd] {
+		return fmt.Errorf("'%s' is not allowed in read-only mode", cmd)
+	}
+
 	switch cmd {
 	case "connect", "open":
 		if r.state.conn != nil {
@@ -71,6 +151,11 @@ func (r *ConnectionHandler) handle(s string) error {
 			config = parts[1]
 		}
 
+		// later settings win, so this overrides any readonly=false
+		if r.readOnly {
+			config = strings.TrimLeft(strings.TrimRight(config, ", ")+",readonly=true", ",")
+		}
+
 		conn, err := wtgo.Open(home, config)
 		if err != nil {
 			return fmt.Errorf("open: %w", err)
@@ -89,7 +174,17 @@ func (r *ConnectionHandler) handle(s string) error {
 			return fmt.Errorf("close: %w", err)
 		}
 
+		// closing the session closed its cursors and rolled back its
+		// transaction too
 		r.state.session = nil
+		r.state.sessionConfig = ""
+		r.state.transaction = false
+		r.state.cursor = nil
+		r.state.schema = schema{}
+		r.state.browser = nil
+		r.stopFollow()
+
+		r.handler.HandleMessage(wtshmsg.ClosedSessionMessage{})
 	case "close-cursor":
 		if r.state.cursor == nil {
 			return fmt.Errorf("no active cursor")
@@ -100,6 +195,7 @@ func (r *ConnectionHandler) handle(s string) error {
 		}
 
 		r.state.cursor = nil
+		r.state.schema = schema{}
 
 		r.handler.HandleMessage(wtshmsg.ClosedCursorMessage{})
 	case "drop":
@@ -137,20 +233,14 @@ func (r *ConnectionHandler) handle(s string) error {
 			return fmt.Errorf("parse: insert <keys> <values>")
 		}
 
-		keyss := parts[0]
-		valuess := parts[1]
-
-		keys := strings.Split(keyss, ",")
-		values := strings.Split(valuess, ",")
-
-		keysa := make([]any, 0, len(keys))
-		for _, k := range keys {
-			keysa = append(keysa, k)
+		keysa, err := r.keyArgs(parts[0])
+		if err != nil {
+			return fmt.Errorf("key: %w", err)
 		}
 
-		valuesa := make([]any, 0, len(values))
-		for _, k := range values {
-			valuesa = append(valuesa, k)
+		valuesa, err := r.valueArgs(parts[1])
+		if err != nil {
+			return fmt.Errorf("value: %w", err)
 		}
 
 		if err := r.state.cursor.SetKey(keysa...); err != nil {
@@ -164,18 +254,27 @@ func (r *ConnectionHandler) handle(s string) error {
 		if err := r.state.cursor.Insert(); err != nil {
 			return fmt.Errorf("insert: %w", err)
 		}
-	case "remove":
+	case "update", "upsert", "modify", "reserve":
 		if r.state.cursor == nil {
 			return fmt.Errorf("no active cursor")
 		}
 
-		keyss := args
+		switch cmd {
+		case "modify":
+			return r.modify(args)
+		case "reserve":
+			return r.reserve(args)
+		}
 
-		keys := strings.Split(keyss, ",")
+		return r.update(cmd, args)
+	case "remove":
+		if r.state.cursor == nil {
+			return fmt.Errorf("no active cursor")
+		}
 
-		keysa := make([]any, 0, len(keys))
-		for _, k := range keys {
-			keysa = append(keysa, k)
+		keysa, err := r.keyArgs(args)
+		if err != nil {
+			return fmt.Errorf("key: %w", err)
 		}
 
 		if err := r.state.cursor.SetKey(keysa...); err != nil {
@@ -198,10 +297,9 @@ func (r *ConnectionHandler) handle(s string) error {
 			return fmt.Errorf("no active cursor")
 		}
 
-		keyss := strings.Split(args, ",")
-		keysa := make([]any, 0, len(keyss))
-		for _, k := range keyss {
-			keysa = append(keysa, k)
+		keysa, err := r.keyArgs(args)
+		if err != nil {
+			return fmt.Errorf("key: %w", err)
 		}
 
 		if err := r.state.cursor.SetKey(keysa...); err != nil {
@@ -212,10 +310,9 @@ func (r *ConnectionHandler) handle(s string) error {
 			return fmt.Errorf("no active cursor")
 		}
 
-		valuess := strings.Split(args, ",")
-		valuesa := make([]any, 0, len(valuess))
-		for _, k := range valuess {
-			valuesa = append(valuesa, k)
+		valuesa, err := r.valueArgs(args)
+		if err != nil {
+			return fmt.Errorf("value: %w", err)
 		}
 
 		if err := r.state.cursor.SetValue(valuesa...); err != nil {
@@ -226,12 +323,17 @@ func (r *ConnectionHandler) handle(s string) error {
 			return fmt.Errorf("no active cursor")
 		}
 
-		if len(args) != 0 {
-			keyss := strings.Split(args, ",")
+		start := time.Now()
 
-			keysa := make([]any, 0, len(keyss))
-			for _, k := range keyss {
-				keysa = append(keysa, k)
+		args, mode, err := displayFlag(args)
+		if err != nil {
+			return err
+		}
+
+		if len(args) != 0 {
+			keysa, err := r.keyArgs(args)
+			if err != nil {
+				return fmt.Errorf("key: %w", err)
 			}
 
 			if err := r.state.cursor.Reset(); err != nil {
@@ -247,98 +349,40 @@ func (r *ConnectionHandler) handle(s string) error {
 			return fmt.Errorf("search: %w", err)
 		}
 
-		keycount := r.state.cursor.KeyCount()
-		valuecount := r.state.cursor.ValueCount()
-
-		n := keycount + valuecount
-		// TODO: is there a less gross way to do this?
-		keys := make([]any, keycount)
-		for i := range keys {
-			var d any
-			keys[i] = &d
-		}
-
-		values := make([]any, valuecount)
-		for i := range values {
-			var d any
-			values[i] = &d
-		}
-
-		if err := r.state.cursor.GetKey(keys...); err != nil {
-			return fmt.Errorf("get key: %w", err)
-		}
-
-		if err := r.state.cursor.GetValue(values...); err != nil {
-			return fmt.Errorf("get key: %w", err)
-		}
-
-		row := make([]string, 0, n)
-
-		for _, k := range keys {
-			d := *k.(*any)
-			row = append(row, fmt.Sprintf("%v", d))
-		}
-
-		for _, v := range values {
-			d := *v.(*any)
-			row = append(row, fmt.Sprintf("%v", d))
+		rec, err := r.readRecord(r.state.cursor)
+		if err != nil {
+			return err
 		}
 
-		r.handler.HandleMessage(wtshmsg.ResultMessage{Rows: [][]string{row}})
+		r.emit([]record{rec}, r.state.schema, mode, time.Since(start))
 	case "search-all-next":
 		if r.state.cursor == nil {
 			return fmt.Errorf("no active cursor")
 		}
 
-		keycount := r.state.cursor.KeyCount()
-		valuecount := r.state.cursor.ValueCount()
+		start := time.Now()
 
-		n := keycount + valuecount
-
-		// TODO: is there a less gross way to do this?
-		keys := make([]any, keycount)
-		for i := range keys {
-			var d any
-			keys[i] = &d
-		}
-
-		values := make([]any, valuecount)
-		for i := range values {
-			var d any
-			values[i] = &d
+		_, mode, err := displayFlag(args)
+		if err != nil {
+			return err
 		}
 
-		rows := make([][]string, 0, 0)
+		records := make([]record, 0)
 
 		for r.state.cursor.Next() {
-			if err := r.state.cursor.GetKey(keys...); err != nil {
-				return fmt.Errorf("get key: %w", err)
-			}
-
-			if err := r.state.cursor.GetValue(values...); err != nil {
-				return fmt.Errorf("get key: %w", err)
+			rec, err := r.readRecord(r.state.cursor)
+			if err != nil {
+				return err
 			}
 
-			row := make([]string, 0, n)
-
-			for _, k := range keys {
-				d := *k.(*any)
-				row = append(row, fmt.Sprintf("%v", d))
-			}
-
-			for _, v := range values {
-				d := *v.(*any)
-				row = append(row, fmt.Sprintf("%v", d))
-			}
-
-			rows = append(rows, row)
+			records = append(records, rec)
 		}
 
 		if err := r.state.cursor.Err(); err != nil {
 			return fmt.Errorf("iteration: %w", err)
 		}
 
-		r.handler.HandleMessage(wtshmsg.ResultMessage{Rows: rows})
+		r.emit(records, r.state.schema, mode, time.Since(start))
 	case "create":
 		if r.state.session == nil {
 			return fmt.Errorf("no active session")
@@ -363,6 +407,18 @@ func (r *ConnectionHandler) handle(s string) error {
 		}
 
 		r.handler.HandleMessage(wtshmsg.CreateMessage{Name: name})
+	case "create-index", "create-colgroup":
+		if r.state.session == nil {
+			return fmt.Errorf("no active session")
+		}
+
+		return r.createSubordinate(strings.TrimPrefix(cmd, "create-"), args)
+	case "describe":
+		if r.state.session == nil {
+			return fmt.Errorf("no active session")
+		}
+
+		return r.describe(args)
 	case "open-cursor":
 		if r.state.session == nil {
 			return fmt.Errorf("no active session")
@@ -393,6 +449,13 @@ func (r *ConnectionHandler) handle(s string) error {
 
 		r.state.cursor = cursor
 
+		sch, err := r.schema(uri)
+		if err != nil {
+			r.logger.Printf("no formats for '%s': %s\n", uri, err)
+		}
+
+		r.state.schema = sch
+
 		r.handler.HandleMessage(wtshmsg.NewCursorMessage{URI: uri})
 	case "open-session":
 		if r.state.conn == nil {
@@ -411,8 +474,15 @@ func (r *ConnectionHandler) handle(s string) error {
 		}
 
 		r.state.session = session
+		r.state.sessionConfig = config
 
 		r.handler.HandleMessage(wtshmsg.NewSessionMessage{})
+	case "begin-transaction", "commit-transaction", "rollback-transaction":
+		if r.state.session == nil {
+			return fmt.Errorf("no active session")
+		}
+
+		return r.transaction(cmd, args)
 	case "disconnect", "close":
 		if r.state.conn == nil {
 			return fmt.Errorf("not connected to a database")
@@ -424,12 +494,97 @@ func (r *ConnectionHandler) handle(s string) error {
 
 		r.handler.HandleMessage(wtshmsg.DatabaseDisconnectedMessage{Home: r.state.home})
 
-		r.state.conn = nil
-		r.state.session = nil
-		r.state.home = ""
+		r.stopFollow()
+		r.state = state{}
+
+	case "readonly":
+		if args != "" {
+			return fmt.Errorf("parse: readonly")
+		}
+
+		// there is deliberately no way back within a session
+		r.readOnly = true
+
+		r.handler.HandleMessage(wtshmsg.ReadOnlyMessage{Connected: r.state.conn != nil})
+	case "set":
+		return r.set(args)
+	case "let":
+		return r.let(args)
+	case "unset":
+		if _, ok := r.vars[args]; !ok {
+			return fmt.Errorf("'%s' is not defined", args)
+		}
+
+		delete(r.vars, args)
+	case "vars":
+		r.handler.HandleMessage(r.variables())
+	case "for", "if", "assert":
+		statements, err := parseScript(s, 1)
+		if err != nil {
+			return unwrapScriptError(err)
+		}
+
+		return unwrapScriptError(r.runScript(statements))
+	case "scan":
+		if r.state.session == nil {
+			return fmt.Errorf("no active session")
+		}
+
+		return r.scan(args)
+	case "log":
+		if r.state.session == nil {
+			return fmt.Errorf("no active session")
+		}
+
+		return r.logCommand(args)
+	case "backup":
+		if r.state.session == nil {
+			return fmt.Errorf("no active session")
+		}
+
+		return r.backup(args)
+	case "bench":
+		if r.state.session == nil {
+			return fmt.Errorf("no active session")
+		}
+
+		return r.bench(args)
+	case "generate":
+		if r.state.session == nil {
+			return fmt.Errorf("no active session")
+		}
+
+		return r.generate(args)
+	case "diff":
+		if r.state.session == nil {
+			return fmt.Errorf("no active session")
+		}
+
+		return r.diff(args)
+	case "browse":
+		if r.state.session == nil {
+			return fmt.Errorf("no active session")
+		}
 
+		return r.browse(args)
+	case `\timing`, `\profile`:
+		return r.profileCommand(cmd, args)
+	case `\display`:
+		return r.displayCommand(args)
+	case `\decode`:
+		return r.decodeCommand(args)
+	case "browse-next", "browse-prev", "browse-seek", "browse-close":
+		return r.browseCommand(cmd, args)
+	case "source":
+		if args == "" {
+			return fmt.Errorf("parse: source <path>")
+		}
+
+		return r.source(args)
 	case "quit":
 		r.cancel()
+
+		return ErrQuit
 	default:
 		return fmt.Errorf("'%s' is not a valid command", cmd)
 	}
@@ -437,6 +592,429 @@ func (r *ConnectionHandler) handle(s string) error {
 	return nil
 }
 
+func (r *ConnectionHandler) readRecord(cursor *wtgo.Cursor) (record, error) {
+	// TODO: is there a less gross way to do this?
+	keys := make([]any, cursor.KeyCount())
+	for i := range keys {
+		var d any
+		keys[i] = &d
+	}
+
+	values := make([]any, cursor.ValueCount())
+	for i := range values {
+		var d any
+		values[i] = &d
+	}
+
+	if err := cursor.GetKey(keys...); err != nil {
+		return record{}, fmt.Errorf("get key: %w", err)
+	}
+
+	if err := cursor.GetValue(values...); err != nil {
+		return record{}, fmt.Errorf("get value: %w", err)
+	}
+
+	rec := record{
+		Key:   make([]any, len(keys)),
+		Value: make([]any, len(values)),
+	}
+
+	for i, k := range keys {
+		rec.Key[i] = *k.(*any)
+	}
+
+	for i, v := range values {
+		rec.Value[i] = *v.(*any)
+	}
+
+	return rec, nil
+}
+
+// emit reports records as a result, formatting fields in the given display
+// mode, or in the modes set with \display if mode is "".
+func (r *ConnectionHandler) emit(records []record, sch schema, mode string, elapsed time.Duration) {
+	if r.capture != nil {
+		*r.capture = append(*r.capture, records...)
+		return
+	}
+
+	m := wtshmsg.ResultMessage{Rows: make([][]string, 0, len(records)), Elapsed: elapsed}
+	m.Columns, m.Keys = columns(records, sch)
+
+	for _, rec := range records {
+		m.Rows = append(m.Rows, r.formatRow(rec, sch.uri, m.Columns, mode, false))
+	}
+
+	r.handler.HandleMessage(m)
+}
+
+// columns describes the columns of records, using the schema alone when
+// there are no records to go by.
+func columns(records []record, sch schema) ([]wtshmsg.Column, int) {
+	if len(records) > 0 {
+		return sch.header(records[0]), len(records[0].Key)
+	}
+
+	empty := record{Key: make([]any, len(sch.keyFormat)), Value: make([]any, len(sch.valueFormat))}
+
+	return sch.header(empty), len(sch.keyFormat)
+}
+
+func (r *ConnectionHandler) variables() wtshmsg.ResultMessage {
+	names := make([]string, 0, len(r.vars))
+	for name := range r.vars {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	rows := make([][]string, 0, len(names))
+	for _, name := range names {
+		v := r.vars[name]
+		rows = append(rows, []string{name, describeValue(v), strings.ReplaceAll(formatValue(v), "\n", "; ")})
+	}
+
+	columns := []wtshmsg.Column{{Name: "name", Type: "S"}, {Name: "type", Type: "S"}, {Name: "value"}}
+
+	return wtshmsg.ResultMessage{Columns: columns, Rows: rows, Keys: 1}
+}
+
+func splitFields(s string) []any {
+	fields := strings.Split(s, ",")
+
+	a := make([]any, 0, len(fields))
+	for _, f := range fields {
+		a = append(a, f)
+	}
+
+	return a
+}
+
+func (r *ConnectionHandler) keyArgs(s string) ([]any, error) {
+	return convertFields(splitFields(s), r.state.schema.keyFormat)
+}
+
+func (r *ConnectionHandler) valueArgs(s string) ([]any, error) {
+	if values, ok, err := r.encodeValues(r.state.schema.uri, s, r.state.schema); ok {
+		return values, err
+	}
+
+	return convertFields(splitFields(s), r.state.schema.valueFormat)
+}
+
+// schema looks up the formats and columns of uri, following an index or a
+// projection back to its table. On failure the returned schema still names
+// uri, so decoders apply without formats.
+func (r *ConnectionHandler) schema(uri string) (schema, error) {
+	return r.schemaIn(r.state.session, uri)
+}
+
+// schemaIn is schema for a table in the database of session.
+func (r *ConnectionHandler) schemaIn(session *wtgo.Session, uri string) (schema, error) {
+	base, projection, projected := splitProjection(uri)
+
+	table := base
+	if strings.HasPrefix(base, "index:") {
+		table = tableURI(base)
+	}
+
+	config, err := r.metadataIn(session, table)
+	if err != nil {
+		return schema{uri: uri}, err
+	}
+
+	sch, err := parseSchema(table, config)
+	if err != nil {
+		return schema{uri: uri}, err
+	}
+
+	keyColumns, valueColumns := sch.keyColumns(), sch.valueColumns()
+
+	if strings.HasPrefix(base, "index:") {
+		config, err := r.metadataIn(session, base)
+		if err != nil {
+			return schema{uri: uri}, err
+		}
+
+		columns, _ := configValue(config, "columns")
+		keyColumns = parseColumns(columns)
+	}
+
+	if projected {
+		valueColumns = projection
+	}
+
+	if base != table || projected {
+		sch, err = sch.project(keyColumns, valueColumns)
+		if err != nil {
+			return schema{uri: uri}, err
+		}
+	}
+
+	sch.uri = uri
+
+	return sch, nil
+}
+
+// metadata returns the configuration stored for uri.
+func (r *ConnectionHandler) metadata(uri string) (string, error) {
+	return r.metadataIn(r.state.session, uri)
+}
+
+func (r *ConnectionHandler) metadataIn(session *wtgo.Session, uri string) (string, error) {
+	meta, err := session.OpenCursor("metadata:", "")
+	if err != nil {
+		return "", fmt.Errorf("open metadata cursor: %w", err)
+	}
+	defer meta.Close()
+
+	if err := meta.SetKey(uri); err != nil {
+		return "", fmt.Errorf("set key: %w", err)
+	}
+
+	if err := meta.Search(); err != nil {
+		return "", fmt.Errorf("search: %w", err)
+	}
+
+	var value any
+	if err := meta.GetValue(&value); err != nil {
+		return "", fmt.Errorf("get value: %w", err)
+	}
+
+	return formatValue(value), nil
+}
+
+const maxSourceDepth = 16
+
+func (r *ConnectionHandler) source(path string) error {
+	if strings.HasPrefix(path, "~/") {
+		dir, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("home directory: %w", err)
+		}
+
+		path = filepath.Join(dir, path[2:])
+	}
+
+	if len(r.sources) >= maxSourceDepth {
+		return fmt.Errorf("source: nesting deeper than %d files", maxSourceDepth)
+	}
+
+	for _, p := range r.sources {
+		if p == path {
+			return fmt.Errorf("source: '%s' is already being sourced", path)
+		}
+	}
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("source: %w", err)
+	}
+
+	statements, err := parseScript(string(src), 1)
+	if err != nil {
+		return sourceError(path, err)
+	}
+
+	r.sources = append(r.sources, path)
+	defer func() {
+		r.sources = r.sources[:len(r.sources)-1]
+	}()
+
+	return sourceError(path, r.runScript(statements))
+}
+
+func sourceError(path string, err error) error {
+	var serr *scriptError
+	if errors.As(err, &serr) {
+		return fmt.Errorf("%s:%d: %w", path, serr.line, serr.err)
+	}
+
+	return err
+}
+
+func unwrapScriptError(err error) error {
+	var serr *scriptError
+	if errors.As(err, &serr) {
+		return serr.err
+	}
+
+	return err
+}
+
+func (r *ConnectionHandler) scan(args string) error {
+	fields := strings.Fields(args)
+
+	if len(fields) == 0 {
+		return fmt.Errorf("parse: scan <uri> [--from key] [--to key] [--limit n] [--display mode]")
+	}
+
+	uri := fields[0]
+
+	var from, to, mode string
+	limit := -1
+
+	for i := 1; i < len(fields); i++ {
+		if i+1 >= len(fields) {
+			return fmt.Errorf("parse: %s requires a value", fields[i])
+		}
+
+		switch fields[i] {
+		case "--from":
+			from = fields[i+1]
+		case "--to":
+			to = fields[i+1]
+		case "--limit":
+			n, err := strconv.Atoi(fields[i+1])
+			if err != nil {
+				return fmt.Errorf("parse: limit: %w", err)
+			}
+
+			limit = n
+		case "--display":
+			if err := validDisplayMode(fields[i+1]); err != nil {
+				return err
+			}
+
+			mode = fields[i+1]
+		default:
+			return fmt.Errorf("parse: unknown option '%s'", fields[i])
+		}
+
+		i++
+	}
+
+	start := time.Now()
+
+	cursor, err := r.state.session.OpenCursor(uri, "")
+	if err != nil {
+		return fmt.Errorf("open cursor: %w", err)
+	}
+	defer cursor.Close()
+
+	sch, err := r.schema(uri)
+	if err != nil {
+		r.logger.Printf("no formats for '%s': %s\n", uri, err)
+	}
+
+	var upper []any
+
+	if to != "" {
+		upper, err = convertFields(splitFields(to), sch.keyFormat)
+		if err != nil {
+			return fmt.Errorf("to: %w", err)
+		}
+	}
+
+	var ok bool
+
+	if from != "" {
+		lower, err := convertFields(splitFields(from), sch.keyFormat)
+		if err != nil {
+			return fmt.Errorf("from: %w", err)
+		}
+
+		if err := cursor.SetKey(lower...); err != nil {
+			return fmt.Errorf("set key: %w", err)
+		}
+
+		cmp, err := cursor.SearchNear()
+		switch {
+		case errors.Is(err, wtgo.ErrNotFound):
+			ok = false
+		case err != nil:
+			return fmt.Errorf("search near: %w", err)
+		case cmp == wtgo.CursorComparisonLessThan:
+			ok = cursor.Next()
+		default:
+			ok = true
+		}
+	} else {
+		ok = cursor.Next()
+	}
+
+	records := make([]record, 0)
+
+	for ; ok && limit != 0; ok = cursor.Next() {
+		rec, err := r.readRecord(cursor)
+		if err != nil {
+			return err
+		}
+
+		if upper != nil {
+			c, err := compareFields(rec.Key, upper)
+			if err != nil {
+				return fmt.Errorf("compare: %w", err)
+			}
+
+			if c > 0 {
+				break
+			}
+		}
+
+		records = append(records, rec)
+
+		if len(records) == limit {
+			break
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("iteration: %w", err)
+	}
+
+	r.emit(records, sch, mode, time.Since(start))
+
+	return nil
+}
+
+// interrupted reports whether Run has been stopped, for long running
+// commands to check so they don't hold up shutdown.
+func (r *ConnectionHandler) interrupted() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Exec runs a single command synchronously. It is for callers that drive the
+// handler without Run, such as batch mode, and must not be mixed with Run.
+func (r *ConnectionHandler) Exec(s string) error {
+	return r.handle(s)
+}
+
+// Do runs s on the goroutine executing Run, reporting messages to handler
+// rather than the handler given to New, and returns the command's error.
+func (r *ConnectionHandler) Do(ctx context.Context, s string, handler MessageHandler) error {
+	done := make(chan error, 1)
+
+	action := func() {
+		previous := r.handler
+		r.handler, r.transient = handler, true
+		done <- r.run(s)
+		r.handler, r.transient = previous, false
+	}
+
+	select {
+	case r.actions <- action:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *ConnectionHandler) Close() error {
+	return r.close()
+}
+
 func (r *ConnectionHandler) close() error {
 	if r.state.conn != nil {
 		if err := r.state.conn.Close(""); err != nil {
@@ -449,6 +1027,7 @@ func (r *ConnectionHandler) close() error {
 
 func (r *ConnectionHandler) Run(ctx context.Context) error {
 	done := ctx.Done()
+	r.done = done
 
 	for {
 		select {
@@ -459,7 +1038,7 @@ func (r *ConnectionHandler) Run(ctx context.Context) error {
 
 			return nil
 		case s := <-r.cmdch:
-			if err := r.handle(s); err != nil {
+			if err := r.run(s); err != nil && !errors.Is(err, ErrQuit) {
 				r.handler.HandleMessage(err)
 			}
 		case a := <-r.actions:
@@ -1,10 +1,11 @@
 package wtshmsg
 
 import (
-	"bytes"
 	"fmt"
+	"strconv"
 	"strings"
-	"text/tabwriter"
+	"time"
+	"unicode/utf8"
 )
 
 type DatabaseConnectedMessage struct {
@@ -23,6 +24,18 @@ func (m DatabaseDisconnectedMessage) String() string {
 	return fmt.Sprintf("disconnected from '%s'", m.Home)
 }
 
+type ReadOnlyMessage struct {
+	Connected bool
+}
+
+func (m ReadOnlyMessage) String() string {
+	if m.Connected {
+		return "read-only mode enabled, the open connection was not opened with readonly=true"
+	}
+
+	return "read-only mode enabled"
+}
+
 type CreateMessage struct {
 	Name string
 }
@@ -46,6 +59,235 @@ func (m NewSessionMessage) String() string {
 	return "new session started"
 }
 
+type ClosedSessionMessage struct {
+}
+
+func (m ClosedSessionMessage) String() string {
+	return "session closed"
+}
+
+type TransactionMessage struct {
+	// State is "started", "committed" or "rolled back"
+	State string
+}
+
+func (m TransactionMessage) String() string {
+	return "transaction " + m.State
+}
+
+// StatusMessage is the executor's state after each command, for the status
+// bar. Empty fields are not open; cache sizes are 0 when statistics are off.
+type StatusMessage struct {
+	Home        string
+	Session     bool
+	Isolation   string
+	Cursor      string
+	KeyFormat   string
+	ValueFormat string
+	Transaction bool
+	Elapsed     time.Duration
+	CacheUsed   int64
+	CacheMax    int64
+}
+
+// Segments lays the status out as short pieces of text for the status bar.
+func (m StatusMessage) Segments() []string {
+	if m.Home == "" {
+		return []string{"not connected"}
+	}
+
+	segments := []string{m.Home}
+
+	if !m.Session {
+		segments = append(segments, "no session")
+	} else {
+		segments = append(segments, "session: "+m.Isolation)
+	}
+
+	if m.Cursor != "" {
+		segments = append(segments, fmt.Sprintf("cursor: %s (%s → %s)", m.Cursor, m.KeyFormat, m.ValueFormat))
+	}
+
+	if m.Transaction {
+		segments = append(segments, "transaction")
+	}
+
+	segments = append(segments, fmt.Sprintf("%.1fms", float64(m.Elapsed)/float64(time.Millisecond)))
+
+	if m.CacheMax > 0 {
+		segments = append(segments, fmt.Sprintf("cache: %s / %s (%d%%)", formatBytes(m.CacheUsed), formatBytes(m.CacheMax), 100*m.CacheUsed/m.CacheMax))
+	}
+
+	return segments
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+
+	f := float64(n)
+	suffix := 0
+
+	for f >= unit && suffix < 4 {
+		f /= unit
+		suffix++
+	}
+
+	return fmt.Sprintf("%.1f%ciB", f, "KMGT"[suffix-1])
+}
+
+type BackupFileMessage struct {
+	File  string
+	Bytes int64
+	// Index counts files copied so far, out of Count
+	Index int
+	Count int
+}
+
+func (m BackupFileMessage) String() string {
+	return fmt.Sprintf("[%d/%d] copied %s (%s)", m.Index, m.Count, m.File, formatBytes(m.Bytes))
+}
+
+type BackupMessage struct {
+	Dest    string
+	Files   int
+	Bytes   int64
+	LogOnly bool
+}
+
+func (m BackupMessage) String() string {
+	kind := "backup"
+	if m.LogOnly {
+		kind = "log backup"
+	}
+
+	return fmt.Sprintf("%s of %d files (%s) written to '%s'", kind, m.Files, formatBytes(m.Bytes), m.Dest)
+}
+
+// ProfileMessage reports what a command cost. Without Profiled only the
+// elapsed time is known.
+type ProfileMessage struct {
+	Elapsed        time.Duration
+	Profiled       bool
+	PagesRequested int64
+	CacheMisses    int64
+	BytesRead      int64
+	BytesWritten   int64
+}
+
+func (m ProfileMessage) String() string {
+	s := fmt.Sprintf("time: %.1fms", float64(m.Elapsed)/float64(time.Millisecond))
+
+	if m.Profiled {
+		s += fmt.Sprintf(", %d pages requested, %d cache misses, %s read, %s written",
+			m.PagesRequested, m.CacheMisses, formatBytes(m.BytesRead), formatBytes(m.BytesWritten))
+	}
+
+	return s
+}
+
+type BenchOp struct {
+	Name string
+	Ops  int64
+	P50  time.Duration
+	P99  time.Duration
+}
+
+// BenchBucket counts operations that took at most Upper and more than the
+// previous bucket's Upper.
+type BenchBucket struct {
+	Upper time.Duration
+	Count int64
+}
+
+// BenchProgressMessage reports the operations a running bench completed in
+// the last interval.
+type BenchProgressMessage struct {
+	URI        string
+	Elapsed    time.Duration
+	Duration   time.Duration
+	Throughput float64
+	Ops        []BenchOp
+	Histogram  []BenchBucket
+}
+
+func (m BenchProgressMessage) String() string {
+	s := fmt.Sprintf("bench %s %.0fs/%.0fs: %.0f ops/s", m.URI, m.Elapsed.Seconds(), m.Duration.Seconds(), m.Throughput)
+
+	for _, op := range m.Ops {
+		s += fmt.Sprintf(", %s p50 %s p99 %s", op.Name, FormatLatency(op.P50), FormatLatency(op.P99))
+	}
+
+	return s
+}
+
+// FormatLatency prints d with three significant digits in the largest unit
+// that keeps it at least one.
+func FormatLatency(d time.Duration) string {
+	switch {
+	case d < time.Microsecond:
+		return fmt.Sprintf("%dns", d)
+	case d < time.Millisecond:
+		return fmt.Sprintf("%.3gµs", float64(d)/float64(time.Microsecond))
+	case d < time.Second:
+		return fmt.Sprintf("%.3gms", float64(d)/float64(time.Millisecond))
+	}
+
+	return fmt.Sprintf("%.3gs", d.Seconds())
+}
+
+type GenerateProgressMessage struct {
+	URI   string
+	Done  int64
+	Count int64
+}
+
+func (m GenerateProgressMessage) String() string {
+	return fmt.Sprintf("[%d/%d] records written to '%s'", m.Done, m.Count, m.URI)
+}
+
+type GenerateMessage struct {
+	URI     string
+	Count   int64
+	Seed    int64
+	Elapsed time.Duration
+}
+
+func (m GenerateMessage) String() string {
+	return fmt.Sprintf("%d records generated in '%s' with seed %d (%.1fs)", m.Count, m.URI, m.Seed, m.Elapsed.Seconds())
+}
+
+// DiffMessage summarizes a diff. Stopped is set if it ended at the limit
+// before either table was exhausted, leaving the counts partial.
+type DiffMessage struct {
+	A       string
+	B       string
+	HomeB   string
+	OnlyA   int
+	OnlyB   int
+	Differ  int
+	Same    int
+	Stopped bool
+}
+
+func (m DiffMessage) String() string {
+	b := m.B
+	if m.HomeB != "" {
+		b = fmt.Sprintf("%s in '%s'", m.B, m.HomeB)
+	}
+
+	s := fmt.Sprintf("%s vs %s: %d only in A, %d only in B, %d differ, %d identical", m.A, b, m.OnlyA, m.OnlyB, m.Differ, m.Same)
+
+	if m.Stopped {
+		s += " (stopped at the limit)"
+	}
+
+	return s
+}
+
 type NewCursorMessage struct {
 	URI string
 }
@@ -61,21 +303,234 @@ func (m ClosedCursorMessage) String() string {
 	return "cursor closed"
 }
 
+type ScriptCommandMessage struct {
+	Path    string
+	Line    int
+	Command string
+}
+
+func (m ScriptCommandMessage) String() string {
+	return m.Command
+}
+
+type Column struct {
+	Name string
+	// Type is the WiredTiger format character of the column, or "" if unknown
+	Type string
+}
+
 type ResultMessage struct {
-	Rows [][]string
+	Columns []Column
+	Rows    [][]string
+	// Keys is the number of leading columns in each row that hold key fields
+	Keys    int
+	Elapsed time.Duration
 }
 
-func (m ResultMessage) String() string {
-	buf := bytes.NewBuffer([]byte{})
-	w := tabwriter.NewWriter(buf, 10, 0, 2, ' ', 0)
-	for i, row := range m.Rows {
-		fmt.Fprint(w, strings.Join(row, "\t"))
-		if i == len(m.Rows)-1 {
+// MaxCellWidth is the widest a column gets before cells are truncated.
+const MaxCellWidth = 40
+
+// Widths returns the display width of each column, fitting the header and
+// every cell up to MaxCellWidth. Multi-line cells such as hex dumps are
+// never truncated, so their lines set the width in full.
+func (m ResultMessage) Widths() []int {
+	widths := make([]int, len(m.Columns))
+	blocks := make([]int, len(m.Columns))
+
+	for i, c := range m.Columns {
+		widths[i] = utf8.RuneCountInString(c.Name)
+	}
+
+	for _, row := range m.Rows {
+		for i, cell := range row {
+			if i == len(widths) {
+				widths = append(widths, 0)
+				blocks = append(blocks, 0)
+			}
+
+			if !strings.Contains(cell, "\n") {
+				widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+				continue
+			}
+
+			for _, l := range strings.Split(cell, "\n") {
+				blocks[i] = max(blocks[i], utf8.RuneCountInString(l))
+			}
+		}
+	}
+
+	for i := range widths {
+		widths[i] = max(min(widths[i], MaxCellWidth), blocks[i])
+	}
+
+	return widths
+}
+
+// SplitRow breaks a row with multi-line cells into one row per line.
+func SplitRow(cells []string) [][]string {
+	lines := [][]string{}
+
+	for i, cell := range cells {
+		for j, l := range strings.Split(cell, "\n") {
+			if j == len(lines) {
+				lines = append(lines, make([]string, len(cells)))
+			}
+
+			lines[j][i] = l
+		}
+	}
+
+	return lines
+}
+
+// Numeric reports whether column i holds numbers and should be right
+// aligned. Columns of unknown type are numeric if every cell parses as one.
+func (m ResultMessage) Numeric(i int) bool {
+	if i < len(m.Columns) && m.Columns[i].Type != "" {
+		return strings.Contains("bBhHiIlLqQrt", m.Columns[i].Type)
+	}
+
+	numeric := false
+
+	for _, row := range m.Rows {
+		if i >= len(row) || row[i] == "" {
 			continue
 		}
 
-		fmt.Fprint(w, "\n")
+		if _, err := strconv.ParseFloat(row[i], 64); err != nil {
+			return false
+		}
+
+		numeric = true
+	}
+
+	return numeric
+}
+
+// Align pads or truncates s to width, with an ellipsis marking truncation.
+func Align(s string, width int, right bool) string {
+	n := utf8.RuneCountInString(s)
+
+	if n > width {
+		if width < 1 {
+			return ""
+		}
+
+		return string([]rune(s)[:width-1]) + "…"
+	}
+
+	pad := strings.Repeat(" ", width-n)
+
+	if right {
+		return pad + s
 	}
-	w.Flush()
-	return buf.String()
+
+	return s + pad
+}
+
+func (m ResultMessage) Footer() string {
+	s := fmt.Sprintf("%d rows", len(m.Rows))
+	if len(m.Rows) == 1 {
+		s = "1 row"
+	}
+
+	if m.Elapsed > 0 {
+		s += fmt.Sprintf(" (%.1fms)", float64(m.Elapsed)/float64(time.Millisecond))
+	}
+
+	return s
+}
+
+// String renders the result as a plain text grid. The footer leaves out the
+// timing so batch output stays stable between runs.
+func (m ResultMessage) String() string {
+	widths := m.Widths()
+	numeric := make([]bool, len(widths))
+
+	for i := range widths {
+		numeric[i] = m.Numeric(i)
+	}
+
+	var b strings.Builder
+
+	row := func(cells []string, header bool) {
+		line := make([]string, len(widths))
+
+		for i, w := range widths {
+			cell := ""
+			if i < len(cells) {
+				cell = cells[i]
+			}
+
+			line[i] = Align(cell, w, numeric[i] && !header)
+		}
+
+		b.WriteString(strings.TrimRight(strings.Join(line, " | "), " ") + "\n")
+	}
+
+	if len(m.Columns) > 0 {
+		names := make([]string, len(m.Columns))
+		for i, c := range m.Columns {
+			names[i] = c.Name
+		}
+
+		row(names, true)
+
+		for i, w := range widths {
+			if i > 0 {
+				b.WriteString("-+-")
+			}
+
+			b.WriteString(strings.Repeat("-", w))
+		}
+
+		b.WriteString("\n")
+	}
+
+	for _, r := range m.Rows {
+		for _, l := range SplitRow(r) {
+			row(l, false)
+		}
+	}
+
+	footer := m
+	footer.Elapsed = 0
+	b.WriteString(footer.Footer())
+
+	return b.String()
+}
+
+type BrowseOpenMessage struct {
+	URI     string
+	Columns []Column
+	Keys    int
+}
+
+func (m BrowseOpenMessage) String() string {
+	return fmt.Sprintf("browsing '%s'", m.URI)
+}
+
+type BrowseDirection int
+
+const (
+	BrowseNext BrowseDirection = iota
+	BrowsePrev
+	// BrowseSeek replaces the rows loaded so far
+	BrowseSeek
+)
+
+type BrowseRow struct {
+	Cells []string
+	// Detail holds the full text of each cell, with raw bytes as a hex dump
+	Detail []string
+}
+
+type BrowsePageMessage struct {
+	Direction BrowseDirection
+	Columns   []Column
+	Keys      int
+	// Rows are in key order, whichever the direction
+	Rows []BrowseRow
+	// End is set once there are no more records in Direction
+	End bool
 }
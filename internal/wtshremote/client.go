@@ -0,0 +1,108 @@
+package wtshremote
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"wtsh/internal/wtshexec"
+)
+
+type Client struct {
+	socket  string
+	cmdch   <-chan string
+	handler wtshexec.MessageHandler
+	logger  *log.Logger
+	cancel  context.CancelFunc
+}
+
+func NewClient(socket string, cmdch <-chan string, logger *log.Logger, handler wtshexec.MessageHandler, cancel context.CancelFunc) *Client {
+	return &Client{
+		socket:  socket,
+		cmdch:   cmdch,
+		handler: handler,
+		logger:  logger,
+		cancel:  cancel,
+	}
+}
+
+func (c *Client) Run(ctx context.Context) error {
+	conn, err := net.Dial("unix", c.socket)
+	if err != nil {
+		return fmt.Errorf("attach to '%s': %w", c.socket, err)
+	}
+	defer conn.Close()
+
+	closed := make(chan struct{})
+
+	go func() {
+		defer close(closed)
+
+		scanner := bufio.NewScanner(conn)
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+		for scanner.Scan() {
+			var resp Response
+
+			if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+				c.handler.HandleMessage(fmt.Errorf("malformed response: %w", err))
+				continue
+			}
+
+			if resp.Type == typeDone {
+				if resp.Error != "" {
+					c.handler.HandleMessage(errors.New(resp.Error))
+				}
+
+				continue
+			}
+
+			m, err := decode(resp)
+			if err != nil {
+				c.handler.HandleMessage(err)
+				continue
+			}
+
+			c.handler.HandleMessage(m)
+		}
+
+		if ctx.Err() == nil {
+			c.handler.HandleMessage(fmt.Errorf("server closed the connection"))
+		}
+	}()
+
+	enc := json.NewEncoder(conn)
+	done := ctx.Done()
+	id := 0
+
+	for {
+		select {
+		case <-done:
+			return nil
+		case s := <-c.cmdch:
+			cmd, args, _ := strings.Cut(s, " ")
+
+			if cmd == "quit" {
+				c.cancel()
+				continue
+			}
+
+			select {
+			case <-closed:
+				c.handler.HandleMessage(fmt.Errorf("not attached to a server"))
+				continue
+			default:
+			}
+
+			id++
+
+			if err := enc.Encode(Request{ID: id, Command: cmd, Args: args}); err != nil {
+				c.handler.HandleMessage(fmt.Errorf("send: %w", err))
+			}
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package wtshremote
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"wtsh/internal/wtshexec"
+)
+
+type Executor interface {
+	Do(ctx context.Context, s string, handler wtshexec.MessageHandler) error
+}
+
+type Server struct {
+	socket   string
+	executor Executor
+	logger   *log.Logger
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+}
+
+func NewServer(socket string, executor Executor, logger *log.Logger) *Server {
+	return &Server{
+		socket:   socket,
+		executor: executor,
+		logger:   logger,
+		conns:    make(map[net.Conn]struct{}),
+	}
+}
+
+func (s *Server) Run(ctx context.Context) error {
+	if err := removeStaleSocket(s.socket); err != nil {
+		return err
+	}
+
+	l, err := net.Listen("unix", s.socket)
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	defer os.Remove(s.socket)
+
+	go func() {
+		<-ctx.Done()
+		l.Close()
+
+		s.mu.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mu.Unlock()
+	}()
+
+	s.logger.Printf("listening on '%s'\n", s.socket)
+
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			s.logger.Println(fmt.Errorf("accept: %w", err))
+			continue
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			s.serve(ctx, conn)
+
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+
+			conn.Close()
+		}()
+	}
+}
+
+// removeStaleSocket removes a socket file left behind by a server that is no
+// longer listening, so a crashed server doesn't block restarts.
+func removeStaleSocket(path string) error {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("stat socket: %w", err)
+	}
+
+	if info.Mode()&fs.ModeSocket == 0 {
+		return fmt.Errorf("'%s' exists and is not a socket", path)
+	}
+
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("a server is already listening on '%s'", path)
+	}
+
+	return os.Remove(path)
+}
+
+type responseWriter struct {
+	mu  *sync.Mutex
+	enc *json.Encoder
+	id  int
+	log *log.Logger
+}
+
+func (w responseWriter) HandleMessage(m any) {
+	resp, err := encode(w.id, m)
+	if err != nil {
+		w.log.Println(err)
+		return
+	}
+
+	w.write(resp)
+}
+
+func (w responseWriter) write(resp Response) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.enc.Encode(resp); err != nil {
+		w.log.Println(fmt.Errorf("write response: %w", err))
+	}
+}
+
+func (s *Server) serve(ctx context.Context, conn net.Conn) {
+	s.logger.Println("client attached")
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	mu := &sync.Mutex{}
+	enc := json.NewEncoder(conn)
+
+	for scanner.Scan() {
+		var req Request
+
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			w := responseWriter{mu: mu, enc: enc, log: s.logger}
+			w.write(Response{Type: typeDone, Error: fmt.Sprintf("malformed request: %s", err)})
+			continue
+		}
+
+		w := responseWriter{mu: mu, enc: enc, id: req.ID, log: s.logger}
+
+		cmd := req.Command
+		if req.Args != "" {
+			cmd += " " + req.Args
+		}
+
+		resp := Response{ID: req.ID, Type: typeDone}
+
+		err := s.executor.Do(ctx, cmd, w)
+
+		// quitting only detaches this client, even from inside a script,
+		// and the connection stays open for the others
+		if errors.Is(err, wtshexec.ErrQuit) {
+			w.write(resp)
+			break
+		}
+
+		if err != nil {
+			resp.Error = err.Error()
+		}
+
+		w.write(resp)
+	}
+
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		s.logger.Println(fmt.Errorf("read request: %w", err))
+	}
+
+	s.logger.Println("client detached")
+}
@@ -0,0 +1,112 @@
+package wtshremote
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"wtsh/internal/wtshmsg"
+)
+
+type Request struct {
+	ID      int    `json:"id"`
+	Command string `json:"command"`
+	Args    string `json:"args,omitempty"`
+}
+
+type Response struct {
+	ID      int             `json:"id"`
+	Type    string          `json:"type"`
+	Message json.RawMessage `json:"message,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+const (
+	typeDone  = "done"
+	typeError = "error"
+	typeText  = "text"
+)
+
+var messageTypes = map[string]reflect.Type{}
+
+func init() {
+	for _, m := range []any{
+		wtshmsg.DatabaseConnectedMessage{},
+		wtshmsg.DatabaseDisconnectedMessage{},
+		wtshmsg.ReadOnlyMessage{},
+		wtshmsg.CreateMessage{},
+		wtshmsg.DropMessage{},
+		wtshmsg.NewSessionMessage{},
+		wtshmsg.ClosedSessionMessage{},
+		wtshmsg.TransactionMessage{},
+		wtshmsg.StatusMessage{},
+		wtshmsg.BackupFileMessage{},
+		wtshmsg.BackupMessage{},
+		wtshmsg.ProfileMessage{},
+		wtshmsg.BenchProgressMessage{},
+		wtshmsg.GenerateProgressMessage{},
+		wtshmsg.GenerateMessage{},
+		wtshmsg.DiffMessage{},
+		wtshmsg.NewCursorMessage{},
+		wtshmsg.ClosedCursorMessage{},
+		wtshmsg.ScriptCommandMessage{},
+		wtshmsg.ResultMessage{},
+		wtshmsg.BrowseOpenMessage{},
+		wtshmsg.BrowsePageMessage{},
+	} {
+		t := reflect.TypeOf(m)
+		messageTypes[t.Name()] = t
+	}
+}
+
+func encode(id int, m any) (Response, error) {
+	switch v := m.(type) {
+	case error:
+		return Response{ID: id, Type: typeError, Error: v.Error()}, nil
+	case string:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return Response{}, err
+		}
+
+		return Response{ID: id, Type: typeText, Message: b}, nil
+	}
+
+	t := reflect.TypeOf(m)
+	if _, ok := messageTypes[t.Name()]; !ok {
+		return Response{}, fmt.Errorf("message type %s is not registered", t)
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return Response{}, fmt.Errorf("marshal %s: %w", t.Name(), err)
+	}
+
+	return Response{ID: id, Type: t.Name(), Message: b}, nil
+}
+
+func decode(r Response) (any, error) {
+	switch r.Type {
+	case typeError:
+		return errors.New(r.Error), nil
+	case typeText:
+		var s string
+		if err := json.Unmarshal(r.Message, &s); err != nil {
+			return nil, err
+		}
+
+		return s, nil
+	}
+
+	t, ok := messageTypes[r.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown message type '%s'", r.Type)
+	}
+
+	v := reflect.New(t)
+	if err := json.Unmarshal(r.Message, v.Interface()); err != nil {
+		return nil, fmt.Errorf("unmarshal %s: %w", r.Type, err)
+	}
+
+	return v.Elem().Interface(), nil
+}
@@ -9,12 +9,15 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"sync"
 	"syscall"
 	"wtsh/internal/inputstream"
 	"wtsh/internal/resizestream"
 	"wtsh/internal/wtshapp"
 	"wtsh/internal/wtshexec"
+	"wtsh/internal/wtshmsg"
+	"wtsh/internal/wtshremote"
 
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/term"
@@ -53,19 +56,21 @@ func runProcessGroup(g *errgroup.Group, ctx context.Context, processes ...Proces
 		}
 
 		g.Go(func() (err error) {
+			// registered first so it runs after the recover, and waiters
+			// are released even when the runner panics
+			defer func() {
+				for _, wg := range p.Waitgroups {
+					wg.Done()
+				}
+			}()
+
 			defer func() {
 				if perr := recover(); perr != nil {
 					err = panicToError(perr)
 				}
 			}()
 
-			err = p.Runner.Run(ctx)
-
-			for _, wg := range p.Waitgroups {
-				wg.Done()
-			}
-
-			return err
+			return p.Runner.Run(ctx)
 		})
 	}
 }
@@ -84,6 +89,15 @@ func panicToError(a any) error {
 }
 
 func run(args []string, stdin *os.File, stdout, stderr io.Writer) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "serve":
+			return runServe(args[1:], stdout, stderr)
+		case "attach":
+			return runAttach(args[1:], stdin, stdout, stderr)
+		}
+	}
+
 	flags := newFlagSet("wtsh")
 
 	var home string
@@ -92,6 +106,10 @@ func run(args []string, stdin *os.File, stdout, stderr io.Writer) error {
 	var cursorConfig string
 	var uri string
 	var logPath string
+	var rcPath string
+	var scriptPath string
+	var themePath string
+	var readOnly bool
 
 	flags.StringVar(&home, "home", "", "")
 	flags.StringVar(&openConfig, "open-config", "", "")
@@ -99,6 +117,152 @@ func run(args []string, stdin *os.File, stdout, stderr io.Writer) error {
 	flags.StringVar(&cursorConfig, "cursor-config", "", "")
 	flags.StringVar(&uri, "uri", "", "")
 	flags.StringVar(&logPath, "log-path", "", "")
+	flags.StringVar(&rcPath, "rc", "", "")
+	flags.StringVar(&scriptPath, "script", "", "")
+	flags.StringVar(&themePath, "theme", "", "")
+	flags.BoolVar(&readOnly, "read-only", false, "")
+
+	ok, err := parseFlags(flags, args, stderr, "")
+	if err != nil {
+		return fmt.Errorf("parse args: %w", err)
+	}
+
+	if !ok {
+		return nil
+	}
+
+	// like a shell, only interactive sessions pick up ~/.wtshrc implicitly
+	if rcPath == "" && scriptPath == "" {
+		rcPath = defaultRCPath()
+	}
+
+	startup := startupCommands(home, openConfig, sessionConfig, uri, cursorConfig, readOnly)
+
+	if rcPath != "" {
+		startup = append(startup, "source "+rcPath)
+	}
+
+	f, logger, err := openLog(logPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if scriptPath != "" {
+		return runBatch(logger, stdout, startup, scriptPath)
+	}
+
+	newExecutor := func(cmdch <-chan string, handler wtshexec.MessageHandler, cancel context.CancelFunc) Runner {
+		return wtshexec.New(cmdch, logger, handler, cancel)
+	}
+
+	theme, err := loadTheme(themePath)
+	if err != nil {
+		return err
+	}
+
+	return runInteractive(logger, stdin, stdout, startup, theme, newExecutor)
+}
+
+func runServe(args []string, stdout, stderr io.Writer) error {
+	flags := newFlagSet("wtsh serve")
+
+	var socket string
+	var home string
+	var openConfig string
+	var sessionConfig string
+	var cursorConfig string
+	var uri string
+	var logPath string
+	var readOnly bool
+
+	flags.StringVar(&socket, "socket", "", "")
+	flags.StringVar(&home, "home", "", "")
+	flags.StringVar(&openConfig, "open-config", "", "")
+	flags.StringVar(&sessionConfig, "session-config", "", "")
+	flags.StringVar(&cursorConfig, "cursor-config", "", "")
+	flags.StringVar(&uri, "uri", "", "")
+	flags.StringVar(&logPath, "log-path", "", "")
+	flags.BoolVar(&readOnly, "read-only", false, "")
+
+	ok, err := parseFlags(flags, args, stderr, "")
+	if err != nil {
+		return fmt.Errorf("parse args: %w", err)
+	}
+
+	if !ok {
+		return nil
+	}
+
+	if socket == "" {
+		return fmt.Errorf("parse args: --socket is required")
+	}
+
+	f, logger, err := openLog(logPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	g, ctx := errgroup.WithContext(context.Background())
+
+	// messages not addressed to a client, e.g. from shutting down
+	printer := batchPrinter{out: stdout}
+
+	// clients share the handler, so quit detaches one through ErrQuit
+	// rather than shutting the server down
+	connHandler := wtshexec.New(nil, logger, printer, func() {})
+	server := wtshremote.NewServer(socket, connHandler, logger)
+
+	cancels := make([]context.CancelFunc, 0, 2)
+
+	{
+		ctx := context.Background()
+		cancel := runCancelGroup(g, ctx, Process{Runner: connHandler})
+		cancels = append(cancels, cancel)
+	}
+
+	for _, cmd := range startupCommands(home, openConfig, sessionConfig, uri, cursorConfig, readOnly) {
+		if err := connHandler.Do(ctx, cmd, printer); err != nil {
+			for _, cancel := range cancels {
+				cancel()
+			}
+
+			g.Wait()
+
+			return err
+		}
+	}
+
+	{
+		ctx, cancel := context.WithCancel(context.Background())
+		runProcessGroup(g, ctx, Process{Runner: server})
+		cancels = append([]context.CancelFunc{cancel}, cancels...)
+	}
+
+	fmt.Fprintf(stdout, "serving on '%s'\n", socket)
+
+	runProcessGroup(g, ctx, Process{Runner: NewCanceler(logger, nil, cancels...)})
+
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func runAttach(args []string, stdin *os.File, stdout, stderr io.Writer) error {
+	flags := newFlagSet("wtsh attach")
+
+	var socket string
+	var logPath string
+	var rcPath string
+	var themePath string
+
+	flags.StringVar(&socket, "socket", "", "")
+	flags.StringVar(&logPath, "log-path", "", "")
+	flags.StringVar(&rcPath, "rc", "", "")
+	flags.StringVar(&themePath, "theme", "", "")
 
 	ok, err := parseFlags(flags, args, stderr, "")
 	if err != nil {
@@ -109,34 +273,69 @@ func run(args []string, stdin *os.File, stdout, stderr io.Writer) error {
 		return nil
 	}
 
+	if socket == "" {
+		return fmt.Errorf("parse args: --socket is required")
+	}
+
+	startup := make([]string, 0, 1)
+
+	if rcPath != "" {
+		startup = append(startup, "source "+rcPath)
+	}
+
+	f, logger, err := openLog(logPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	newExecutor := func(cmdch <-chan string, handler wtshexec.MessageHandler, cancel context.CancelFunc) Runner {
+		return wtshremote.NewClient(socket, cmdch, logger, handler, cancel)
+	}
+
+	theme, err := loadTheme(themePath)
+	if err != nil {
+		return err
+	}
+
+	return runInteractive(logger, stdin, stdout, startup, theme, newExecutor)
+}
+
+func openLog(logPath string) (*os.File, *log.Logger, error) {
 	var f *os.File
 
 	if logPath != "" {
 		lf, err := os.Create(logPath)
 		if err != nil {
-			return fmt.Errorf("create log file: %w", err)
+			return nil, nil, fmt.Errorf("create log file: %w", err)
 		}
 
 		f = lf
 	} else {
 		null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0755)
 		if err != nil {
-			return fmt.Errorf("open /dev/null: %w", err)
+			return nil, nil, fmt.Errorf("open /dev/null: %w", err)
 		}
 
 		f = null
 	}
-	defer f.Close()
 
 	logfd := f.Fd()
 
 	// TODO: temporary until wtgo can silence stderr/stdout logging
 	if err := syscall.Dup2(int(logfd), int(syscall.Stderr)); err != nil {
-		return fmt.Errorf("redirect stderr to log file")
+		f.Close()
+		return nil, nil, fmt.Errorf("redirect stderr to log file")
 	}
 
 	logger := log.New(f, "", log.LUTC|log.Ldate|log.Ltime|log.Lmicroseconds|log.Lshortfile)
 
+	return f, logger, nil
+}
+
+type executorFunc func(cmdch <-chan string, handler wtshexec.MessageHandler, cancel context.CancelFunc) Runner
+
+func runInteractive(logger *log.Logger, stdin *os.File, stdout io.Writer, startup []string, theme wtshapp.Theme, newExecutor executorFunc) error {
 	fd := int(os.Stdin.Fd())
 
 	w, h, err := term.GetSize(fd)
@@ -163,18 +362,15 @@ func run(args []string, stdin *os.File, stdout, stderr io.Writer) error {
 		Cancel:         cancel,
 		CommandChannel: cmdch,
 		Logger:         logger,
-		Home:           home,
-		OpenConfig:     openConfig,
-		SessionConfig:  sessionConfig,
-		CursorConfig:   cursorConfig,
-		URI:            uri,
+		Startup:        startup,
+		Theme:          theme,
 	}
 
 	p := wtshapp.New(wtshappconf)
 
 	defer p.Reset()
 
-	connHandler := wtshexec.New(cmdch, logger, p, cancel)
+	connHandler := newExecutor(cmdch, p, cancel)
 
 	resizer := resizestream.New(fd, logger, p)
 	reader := inputstream.New(stdin, logger, p)
@@ -223,7 +419,7 @@ func run(args []string, stdin *os.File, stdout, stderr io.Writer) error {
 		runProcessGroup(g, ctx, wtshappp, waiterp)
 	}
 
-	canceler := NewCanceler(logger, cancels...)
+	canceler := NewCanceler(logger, p.Reset, cancels...)
 
 	{
 		cancelerp := Process{
@@ -234,13 +430,148 @@ func run(args []string, stdin *os.File, stdout, stderr io.Writer) error {
 		runProcessGroup(g, ctx, cancelerp)
 	}
 
-	if err := g.Wait(); err != nil {
-		return err
+	err = g.Wait()
+
+	p.Reset()
+
+	if summary := p.Summary(); summary != "" {
+		fmt.Fprintln(stdout, summary)
+	}
+
+	return err
+}
+
+func startupCommands(home, openConfig, sessionConfig, uri, cursorConfig string, readOnly bool) []string {
+	cmds := make([]string, 0, 5)
+
+	// before open, so the connection itself is opened with readonly=true
+	if readOnly {
+		cmds = append(cmds, "readonly")
+	}
+
+	if home == "" {
+		return cmds
+	}
+
+	cmd := "open " + home
+	if openConfig != "" {
+		cmd += " " + openConfig
+	}
+	cmds = append(cmds, cmd)
+
+	cmd = "open-session"
+	if sessionConfig != "" {
+		cmd += " " + sessionConfig
+	}
+	cmds = append(cmds, cmd)
+
+	if uri != "" {
+		cmd = fmt.Sprintf("open-cursor %s", uri)
+		if cursorConfig != "" {
+			cmd += " " + cursorConfig
+		}
+
+		cmds = append(cmds, cmd)
+	}
+
+	return cmds
+}
+
+type batchPrinter struct {
+	out io.Writer
+}
+
+func (b batchPrinter) HandleMessage(m any) {
+	switch v := m.(type) {
+	case error:
+		fmt.Fprintln(b.out, v.Error())
+	case string:
+		fmt.Fprintln(b.out, v)
+	case wtshmsg.ScriptCommandMessage:
+	case fmt.Stringer:
+		fmt.Fprintln(b.out, v.String())
+	}
+}
+
+func runBatch(logger *log.Logger, stdout io.Writer, startup []string, scriptPath string) error {
+	handler := wtshexec.New(nil, logger, batchPrinter{out: stdout}, func() {})
+
+	cmds := append(startup, "source "+scriptPath)
+
+	for _, cmd := range cmds {
+		err := handler.Exec(cmd)
+
+		// quit ends the script early, which isn't a failure
+		if errors.Is(err, wtshexec.ErrQuit) {
+			break
+		}
+
+		if err != nil {
+			if cerr := handler.Close(); cerr != nil {
+				logger.Println(cerr)
+			}
+
+			return err
+		}
+	}
+
+	if err := handler.Close(); err != nil {
+		return fmt.Errorf("close: %w", err)
 	}
 
 	return nil
 }
 
+// defaultRCPath returns ~/.wtshrc if it exists, and "" otherwise.
+func defaultRCPath() string {
+	dir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	path := filepath.Join(dir, ".wtshrc")
+
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+
+	return path
+}
+
+// loadTheme reads the theme at path, or at ~/.config/wtsh/theme if path is
+// empty and that file exists. Colors are dropped when NO_COLOR is set.
+func loadTheme(path string) (wtshapp.Theme, error) {
+	theme := wtshapp.DefaultTheme()
+
+	if path == "" {
+		if dir, err := os.UserConfigDir(); err == nil {
+			if _, err := os.Stat(filepath.Join(dir, "wtsh", "theme")); err == nil {
+				path = filepath.Join(dir, "wtsh", "theme")
+			}
+		}
+	}
+
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return wtshapp.Theme{}, fmt.Errorf("open theme: %w", err)
+		}
+		defer f.Close()
+
+		theme, err = wtshapp.LoadTheme(f, theme)
+		if err != nil {
+			return wtshapp.Theme{}, fmt.Errorf("load theme '%s': %w", path, err)
+		}
+	}
+
+	// https://no-color.org
+	if os.Getenv("NO_COLOR") != "" {
+		theme = theme.WithoutColor()
+	}
+
+	return theme, nil
+}
+
 type Waiter struct {
 	wg      *sync.WaitGroup
 	cancels []context.CancelFunc
@@ -258,12 +589,14 @@ func (w *Waiter) Run(ctx context.Context) error {
 
 type Canceler struct {
 	logger  *log.Logger
+	restore func()
 	cancels []context.CancelFunc
 }
 
-func NewCanceler(logger *log.Logger, cancels ...context.CancelFunc) *Canceler {
+func NewCanceler(logger *log.Logger, restore func(), cancels ...context.CancelFunc) *Canceler {
 	return &Canceler{
 		logger:  logger,
+		restore: restore,
 		cancels: cancels,
 	}
 }
@@ -279,6 +612,15 @@ func (c *Canceler) Run(ctx context.Context) error {
 		c.logger.Printf("\nreceived signal '%s', shutting down...\n", s)
 	}
 
+	// restore now rather than after shutdown, which may hang on a long
+	// running WiredTiger call, or never finish if a process panicked
+	if c.restore != nil {
+		c.restore()
+	}
+
+	// a second signal falls through to the default handler and kills us
+	signal.Stop(signals)
+
 	for _, cancel := range c.cancels {
 		cancel()
 	}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestScriptExitStatus runs wtsh --script, which exits non-zero exactly when
+// run returns an error.
+func TestScriptExitStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		err    string
+	}{
+		{name: "passing", script: "set a = 1\nassert $a == 1\n"},
+		{name: "failing assert", script: "set a = 1\nassert $a == 2\nassert true\n", err: ":2: assertion failed: $a == 2 (1 == 2)"},
+		{name: "failing assert in a block", script: "if 1 > 2 {\n} else {\n  assert false\n}\n", err: ":3: assertion failed: false"},
+		{name: "quit before a failure", script: "quit\nassert false\n"},
+		{name: "unknown command", script: "nope\n", err: ":1: 'nope' is not a valid command"},
+		{name: "parse error", script: "if true {\n", err: ":1: missing '}'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "script.wtsh")
+
+			if err := os.WriteFile(path, []byte(tt.script), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			var stdout, stderr bytes.Buffer
+
+			err := run([]string{"--script", path}, nil, &stdout, &stderr)
+
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("got %s, want no error", err)
+			case tt.err != "" && err == nil:
+				t.Errorf("got no error, want %s", tt.err)
+			case tt.err != "" && err.Error() != path+tt.err:
+				t.Errorf("got %s, want %s%s", err, path, tt.err)
+			}
+		})
+	}
+}
+
+func TestStartupCommands(t *testing.T) {
+	got := startupCommands("db", "create,cache_size=1G", "isolation=snapshot", "table:t", "raw", true)
+
+	want := []string{
+		"readonly",
+		"open db create,cache_size=1G",
+		"open-session isolation=snapshot",
+		"open-cursor table:t raw",
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if got := startupCommands("", "create", "", "", "", false); len(got) != 0 {
+		t.Errorf("got %q without a home, want nothing", got)
+	}
+}